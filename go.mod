@@ -2,7 +2,13 @@ module xl
 
 go 1.18
 
-require github.com/xuri/excelize/v2 v2.6.0
+require (
+	github.com/BurntSushi/toml v1.2.1
+	github.com/xuri/excelize/v2 v2.6.0
+	golang.org/x/term v0.0.0-20210927222741-03fcf44c2211
+	golang.org/x/text v0.3.7
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
@@ -12,5 +18,5 @@ require (
 	github.com/xuri/nfp v0.0.0-20220409054826-5e722a1d9e22 // indirect
 	golang.org/x/crypto v0.0.0-20220408190544-5352b0902921 // indirect
 	golang.org/x/net v0.0.0-20220407224826-aac1ed45d8e3 // indirect
-	golang.org/x/text v0.3.7 // indirect
+	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e // indirect
 )
@@ -4,19 +4,100 @@
 package main
 
 import (
+	"archive/zip"
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
+	"go/format"
+	"go/token"
+	"html"
+	"io"
+	"io/fs"
+	"math"
+	"math/rand"
+	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/BurntSushi/toml"
 	xl "github.com/xuri/excelize/v2"
+	"golang.org/x/term"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+	"gopkg.in/yaml.v3"
 )
 
 type Mode int
 
+func (m Mode) String() string {
+	switch m {
+	case Map:
+		return "Map"
+	case MultiSheet:
+		return "MultiSheet"
+	case Matrix:
+		return "Matrix"
+	case Stats:
+		return "Stats"
+	}
+	return "Mode(" + strconv.Itoa(int(m)) + ")"
+}
+
+var (
+	// Build of xl, set with -ldflags "-X main.version=..."
+	version = "dev"
+
+	// Signature of an OLE compound file, as used by encrypted workbooks and legacy .xls
+	oleMagic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+	// Signature of a gzip stream, as in .xlsx.gz
+	gzipMagic = []byte{0x1F, 0x8B}
+
+	// Signature of a zip file's first local header
+	zipMagic = []byte("PK\x03\x04")
+
+	// Content of the mimetype file OpenDocument spreadsheets store first, uncompressed
+	odsMime = []byte("application/vnd.oasis.opendocument.spreadsheet")
+
+	// Title of the -with-index column
+	indexTitle = "_row"
+
+	// Title of the column of row IDs kept through the row filters for -hyperlinks, which no cell can hold
+	rowIDTitle = "\x00id"
+
+	// UTF-16LE name of the stream only present in encrypted workbooks
+	encryptionInfo = []byte("E\x00n\x00c\x00r\x00y\x00p\x00t\x00i\x00o\x00n\x00I\x00n\x00f\x00o\x00")
+)
+
+// Exit codes, so scripts can tell failures apart
+const (
+	exitFailure    = 1 // Anything not listed below
+	exitNotFound   = 2 // Input file doesn't exist
+	exitNoSheet    = 3 // Requested sheet doesn't exist
+	exitParse      = 4 // Input or an expression couldn't be parsed
+	exitEncryption = 5 // Workbook is encrypted and the password is missing or wrong
+)
+
 const (
 	Map Mode = iota
 	MultiSheet
@@ -25,200 +106,5093 @@ const (
 )
 
 var (
-	allSheets     = flag.Bool("all", false, "Process all sheets")
-	useSheet      = flag.String("sheet", "", "Excel sheet to search; empty uses first sheet in file")
-	noColNames    = flag.Bool("notitles", false, "Sheet does _not_ have column names as row 0; default has col names; forces Matrix mode")
-	stripColNames = flag.Bool("striptitles", false, "Column names exist and should be elided from the output; forces Matrix mode")
-	tableMode     = flag.Bool("table", false, "Output should be a 2D matrix rather than a map→key object")
-	statsMode     = flag.Bool("stats", false, "Print fun sheet statistics")
-	asJson        = flag.Bool("json", false, "Output format should be JSON")
-	asGo          = flag.Bool("go", false, "Output format should be in Go syntax")
-	asCSV         = flag.Bool("csv", false, "Output format should be CSV; implies Matrix mode")
-	//useAlphaTitles = flag.Bool("alphatitles", false, "Rather than using col[0] as the title, use the convention A0, B0, etc.")
-
-	inPath  = flag.String("i", "", "Excel file to read from; default stdin")
-	outPath = flag.String("o", "", "Output file to write to; default stdout")
-)
+	allSheets       = flag.Bool("all", false, "Process all sheets")
+	useSheet        = flag.String("sheet", "", "Excel sheet to search; empty uses the active sheet in file")
+	sheetList       = flag.String("sheets", "", "Comma-separated list of Excel sheets to process in order; conflicts with -sheet")
+	dedupRows       = flag.Bool("dedup", false, "Remove data rows that repeat an earlier row, keeping the first")
+	dedupOn         = flag.String("dedup-on", "", "Comma-separated column names that decide whether rows are duplicates; implies -dedup")
+	expectList      = flag.String("expect-cols", "", "Fail unless each sheet's titles are exactly these comma-separated columns, in order")
+	expectUnordered = flag.Bool("expect-unordered", false, "Let the -expect-cols columns be in any order")
+	flatten         = flag.Bool("flatten", false, "Stack the rows of all the sheets read into one table, matching columns by title; needs -all, -sheets, or -sheet-match")
+	sheetCol        = flag.String("sheet-col", "", "With -flatten, add a column of this title naming each row's sheet")
+	joinSheets      = flag.String("join-sheets", "", "Join two comma-separated sheets on -join-on into one table; conflicts with other sheet selection")
+	joinOn          = flag.String("join-on", "", "Key column name for -join-sheets")
+	joinType        = flag.String("join-type", "inner", "Kind of -join-sheets join: inner or left")
+	sampleRows      = flag.Int("sample", 0, "Keep this many data rows chosen at random, in their original order")
+	seed            = flag.Int64("seed", 0, "Random seed for -sample, to choose the same rows every run; 0 is random")
+	pivot           = flag.Bool("pivot", false, "Cross-tabulate data rows: one row per -pivot-rows value and one column per -pivot-cols value, holding -pivot-val summarized by -pivot-agg")
+	pivotRowCol     = flag.String("pivot-rows", "", "Column whose distinct values become the rows of -pivot")
+	pivotColCol     = flag.String("pivot-cols", "", "Column whose distinct values become the columns of -pivot")
+	pivotValCol     = flag.String("pivot-val", "", "Column summarized in each cell of -pivot")
+	pivotAggFn      = flag.String("pivot-agg", "sum", "Function summarizing -pivot cells: sum, avg, min, max, or count; cells with no rows are empty, or 0 when counting")
+	groupBy         = flag.String("group-by", "", "Collapse data rows into one per distinct value of the named column, summarized by -agg")
+	grepPat         = flag.String("grep", "", "Keep only data rows with a cell matching this regular expression")
+	grepVPat        = flag.String("grep-v", "", "Drop data rows with a cell matching this regular expression")
+	decimalSep      = flag.String("decimal-sep", ".", "Decimal separator of numbers in cells, as in 1234,56 with ','; used by stats, -sort, and -agg")
+	thousandsSep    = flag.String("thousands-sep", "", "Digit grouping separator of numbers in cells, as in 1.234,56 with '.'; empty allows none")
+	sortBy          = flag.String("sort", "", "Sort data rows by the named column as COL or COL:desc; numeric if all its values are numbers; requires titles")
+	sheetMatch      = flag.String("sheet-match", "", "Process all sheets whose names match this regular expression; conflicts with -sheet")
+	firstSheet      = flag.Bool("first", false, "Read the first sheet rather than the active one when no sheet is selected")
+	pickSheet       = flag.Bool("interactive", false, "When no sheet is selected and the workbook has several, list them and ask which to read; only if stdin is a terminal")
+	sheetIndex      = flag.Int("sheet-index", -1, "0-based position of the Excel sheet to search; conflicts with -sheet")
+	noColNames      = flag.Bool("notitles", false, "Sheet does _not_ have column names as row 0; default has col names; forces Matrix mode")
+	stripColNames   = flag.Bool("striptitles", false, "Column names exist and should be elided from the output; forces Matrix mode")
+	tableMode       = flag.Bool("table", false, "Output should be a 2D matrix rather than a map→key object")
+	renameCols      = flag.String("rename-cols", "", "Comma-separated OLD=NEW pairs renaming column titles, after -columns selects them")
+	colList         = flag.String("columns", "", "Comma-separated list of column names to output, in that order; conflicts with -notitles")
+	definedName     = flag.String("name", "", "Only read the range of this workbook-defined name, on its sheet; its first row holds the titles")
+	colRange        = flag.String("col-range", "", "Only read the columns of a C:F style range of column letters, regardless of titles; C: reads to the last column")
+	cellRange       = flag.String("range", "", "Only read the cells of an A1:B2 style range, clamped to the sheet; its first row holds the titles")
+	skipRows        = flag.Int("skip-rows", 0, "Discard this many leading rows, counted from the top of -range if set, so the next holds the titles")
+	rowRange        = flag.String("rows", "", "Only keep sheet rows START:END, 1-based and inclusive; END may be omitted; titles are always kept")
+	dropEmptyRows   = flag.Bool("drop-empty-rows", false, "Remove data rows whose cells are all empty or whitespace")
+	dropEmptyCols   = flag.Bool("drop-empty-cols", false, "Remove columns whose data cells are all empty or whitespace; titled columns are kept")
+	dropTitledEmpty = flag.Bool("drop-titled-empty", false, "Like -drop-empty-cols, but also remove empty columns that have a title")
+	rowLimit        = flag.Int("limit", 0, "Stop after this many data rows in all, across sheets; 0 is unlimited")
+	headRows        = flag.Int("head", 0, "Only keep the first N data rows; conflicts with -tail")
+	tailRows        = flag.Int("tail", 0, "Only keep the last N data rows; conflicts with -head")
+	dupMerge        = flag.Bool("dup-merge", false, "Append the values of columns with a duplicate title to the first such column rather than renaming them Title_2, Title_3, ...")
+	transpose       = flag.Bool("transpose", false, "Swap rows and columns before output; in Map mode the first cell of each row becomes its key")
+	showVersion     = flag.Bool("version", false, "Print the version of xl and of the excelize library it was built with, then exit")
+	failOnErrors    = flag.Bool("fail-on-errors", false, "Exit non-zero without output if any cell holds an error value such as #REF! or #DIV/0!")
+	stream          = flag.Bool("stream", false, "Read rows one at a time and write them as they're read, for workbooks too large to hold in memory; -csv, -tsv, or -ndjson only, and no whole-sheet features such as -transpose or -sort; rows without titles aren't padded to the same width")
+	jobs            = flag.Int("jobs", 1, "Number of sheets to read at once")
+	dryRun          = flag.Bool("dry-run", false, "Read and filter the sheets, then print the sheets, columns, row counts, and flags that would be used to stderr without writing output")
+	noInfo          = flag.Bool("no-info", false, "Don't print the summary line of sheets, columns, and cells read to stderr; warnings are still printed")
+	quiet           = flag.Bool("quiet", false, "Don't print info lines or warnings to stderr; errors are still printed")
+	verbose         = flag.Bool("verbose", false, "Also print the time taken and cells read per sheet to stderr")
+	checksum        = flag.Bool("checksum", false, "Print a SHA-256 of each selected sheet's raw cell values as 'sheet: hash', then exit; JSON with -json")
+	countDistinct   = flag.String("count-distinct", "", "Print the number of distinct values in the named column of the selected sheets, then exit; JSON with -json")
+	listDistinct    = flag.Bool("list-distinct", false, "With -count-distinct, also print the sorted distinct values, one per line")
+	ignoreEmpty     = flag.Bool("ignore-empty", false, "With -count-distinct, don't count empty cells as a value")
+	countOnly       = flag.Bool("count", false, "Print the data row and column counts of the selected sheets, then exit; JSON with -json")
+	listSheets      = flag.Bool("list", false, "List each sheet with its row and column counts, tab-separated, then exit; JSON with -json")
+	statsMode       = flag.Bool("stats", false, "Print fun sheet statistics; with -json, each sheet has its columns in order with their row counts")
+	asJson          = flag.Bool("json", false, "Output format should be JSON")
+	indent          = flag.Int("indent", 0, "Number of spaces to indent JSON and XML output by; 0 is compact")
+	asGo            = flag.Bool("go", false, "Output format should be in Go syntax")
+	goFmt           = flag.Bool("gofmt", false, "Format -go output with gofmt, one element per line")
+	goPackage       = flag.String("go-package", "", "Make -go and -gostruct output a complete file in this package; -go assigns to -go-var")
+	goVar           = flag.String("go-var", "", "Assign -go output to a variable of this name; defaults to Book with -go-package")
+	asGoStruct      = flag.Bool("gostruct", false, "Output format should be a Go struct type per sheet plus a slice of its rows; requires Map mode")
+	asYAML          = flag.Bool("yaml", false, "Output format should be YAML")
+	asSparse        = flag.Bool("sparse", false, "Output format should be a JSON map of sheet→A1 address→value holding only non-empty cells, at their sheet addresses")
+	asRecords       = flag.Bool("records", false, "Output format should be a JSON array of row objects keyed by column name; requires Map mode")
+	keyOrder        = flag.String("order", "original", "Key order of -records and -ndjson objects: original, as the columns are, or sorted")
+	asFlat          = flag.Bool("flat", false, "Output format should be one flat JSON object per row, keyed by column name, with -prefix and, with many sheets, 'Sheet.' before each key; requires Map mode")
+	flatPrefix      = flag.String("prefix", "", "Text before every key of -flat output")
+	asNDJSON        = flag.Bool("ndjson", false, "Output format should be newline-delimited JSON, one object per row; requires Map mode")
+	asTOML          = flag.Bool("toml", false, "Output format should be TOML; requires Map mode; keys with spaces are quoted automatically")
+	templatePath    = flag.String("template", "", "Execute this Go text/template file; .Sheets maps sheet→records, .Columns sheet→titles in order; requires Map mode")
+	asJSONSchema    = flag.Bool("jsonschema", false, "Output a draft-07 JSON Schema for the records of each sheet, with types inferred from the cells; requires Map mode")
+	asXML           = flag.Bool("xml", false, "Output format should be XML, a <sheet name=...> per sheet of <row>s of <cell>s; Map mode cells carry their column name")
+	asSQL           = flag.Bool("sql", false, "Output format should be SQL INSERT statements, one per row; requires Map mode")
+	sqlTable        = flag.String("sql-table", "", "Table name for SQL output; empty uses the sheet name")
+	sqlNullEmpty    = flag.Bool("sql-null-empty", false, "Empty cells should be NULL rather than '' in SQL output")
+	asPretty        = flag.Bool("pretty", false, "Output format should be a box-drawing table for reading in a terminal; implies Matrix mode")
+	maxWidth        = flag.Int("max-width", 40, "Widest -pretty cell in characters before it's cut short with …; 0 is unlimited")
+	asMarkdown      = flag.Bool("markdown", false, "Output format should be a GitHub-flavored Markdown table; implies Matrix mode")
+	asHTML          = flag.Bool("html", false, "Output format should be an HTML table; implies Matrix mode")
+	appendTo        = flag.String("append-to", "", "With -xlsx, add the output sheets to this existing workbook rather than writing a new one")
+	newSheetName    = flag.String("sheet-name", "", "Name of the sheet written by -xlsx; empty uses the source sheet's name")
+	overwriteSheet  = flag.Bool("overwrite-sheet", false, "With -append-to, replace a sheet of the same name rather than failing")
+	asXLSX          = flag.Bool("xlsx", false, "Output format should be an Excel workbook with a sheet per source sheet; implies Matrix mode; requires -o")
+	asCSV           = flag.Bool("csv", false, "Output format should be CSV; implies Matrix mode; multiple sheets are separated by a blank line")
+	delimiter       = flag.String("delimiter", ",", "Single-character field delimiter for CSV input and output")
+	encodingName    = flag.String("encoding", "utf-8", "Text encoding of -from-csv input and CSV and TSV output, such as windows-1252 or latin1")
+	bom             = flag.Bool("bom", false, "Start CSV and TSV output with a UTF-8 byte order mark for Excel")
+	asTSV           = flag.Bool("tsv", false, "Output format should be TSV; implies Matrix mode")
+	mergeHeaders    = flag.Int("merge-headers", 0, "Titles span this many rows, merged into one title per column joined by -header-sep; empty upper cells repeat the one to their left")
+	headerSep       = flag.String("header-sep", " ", "Separator between the parts of -merge-headers titles")
+	alphaKeys       = flag.Bool("alpha-keys", false, "Title columns by their letters, A, B, C, etc., keeping the first row as data; for sheets without titles")
 
-func main() {
-	mode := Map                                     // Used in Matrix mode
-	bookTab := make(map[string]map[string][]string) // If using all sheets and table format per-sheet
-	bookMat := make(map[string][][]string)          // If using all sheets 2D matrix format per-sheet
+	rawValues    = flag.Bool("raw", false, "Use raw cell values rather than applying number formats, e.g. 1000 rather than $1,000.00")
+	hyperlinks   = flag.Bool("hyperlinks", false, "Include cell hyperlinks; JSON output has {text, link} objects, other formats have 'text (link)'")
+	withStyles   = flag.Bool("styles", false, "Include cell fill colors and bold/italic fonts; needs -json output, which has a parallel _styles map of sheet→address→style")
+	withComments = flag.Bool("comments", false, "Include cell comments; -json output has a parallel _comments map of sheet→address→comment, other formats have 'text (comment)'")
+	snakeTitles  = flag.Bool("snake", false, "Rewrite column titles as snake_case keys; ignored with -notitles")
+	protoSafe    = flag.Bool("proto-safe", false, "Like -snake, but keys are also valid Protocol Buffers field names: ASCII only and not starting with a digit")
+	printMapping = flag.Bool("print-mapping", false, "With -snake or -proto-safe, print each original title and the key it became to stderr")
+	keepOriginal = flag.Bool("keep-original", false, "With -snake, keep the original titles; -json output has a parallel _titles map of sheet→key→title, others log them to stderr")
+	maxCellLen   = flag.Int("max-cell-length", 0, "Cut every cell, titles included, to at most this many characters; 0 is unlimited")
+	truncMarker  = flag.String("truncate-marker", "…", "Text appended to cells cut by -max-cell-length")
+	trim         = flag.Bool("trim", false, "Strip leading and trailing whitespace from every cell, titles included")
+	unmerge      = flag.Bool("unmerge", false, "Fill every cell of a merged range with the value of its top-left cell")
+	dates        = flag.Bool("dates", false, "Convert date-formatted numeric cells to YYYY-MM-DD")
+	dateTimes    = flag.Bool("datetime", false, "Like -dates, but convert to RFC 3339 date-times")
+	dateLayout   = flag.String("date-format", "", "Go time layout for -dates, e.g. 02/01/2006; implies -dates")
+	castList     = flag.String("cast", "", "Write the cells of these columns as JSON numbers or booleans, as in Age:int,Price:float,Active:bool; cells that don't parse are null")
+	nullAs       = flag.String("null-as", "empty", "How to write empty cells: empty, null (JSON null in JSON output, empty elsewhere), or any other text to write instead")
+	boolAs       = flag.String("bool-as", "", "Rewrite columns whose cells are all TRUE/FALSE, yes/no, or 1/0 as json (true/false, JSON booleans with -json), yesno, or 10")
+	textCols     = flag.String("text-columns", "", "Comma-separated column names whose cells are text, kept as stored: never evaluated, converted, or typed as numbers")
+	evalFormulas = flag.Bool("eval", false, "Replace formula cells with their calculated value")
+	fromCSV      = flag.Bool("from-csv", false, "Input is CSV rather than Excel; it's read as a single sheet")
+	password     = flag.String("password", "", "Password for an encrypted workbook; default is the XL_PASSWORD environment variable")
+
+	inPath    = flag.String("i", "", "Excel, OpenDocument, or CSV file, or http(s) URL, to read from; default stdin; trailing arguments are more inputs whose rows are combined")
+	withIndex = flag.Bool("with-index", false, "Add a first column, titled "+indexTitle+", of each row's 1-based sheet row number, kept through filters and sorting")
+	sourceCol = flag.String("source-col", "", "Add a column of this title naming the input each row came from")
+	outPath   = flag.String("o", "", "Output file to write to; default stdout; gzip compressed if it ends in .gz")
+	gzipOut   = flag.Bool("gzip", false, "Compress the output with gzip, including to stdout")
+	split     = flag.Bool("split", false, "Write each sheet to its own file, named by replacing {sheet} in -o, or in the -o directory")
+)
 
+// Read a workbook from a file, URL, or stdin if path is empty, as Excel or -from-csv CSV
+func loadWorkbook(path string, comma rune, enc encoding.Encoding) *xl.File {
 	in := bufio.NewReader(os.Stdin)
-	out := bufio.NewWriter(os.Stdout)
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		body, err := fetch(path, headers)
+		efatal(err, "could not fetch input URL")
+		in = bufio.NewReader(bytes.NewReader(body))
+	} else if path != "" {
+		f, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			efatalCode(exitNotFound, err, "could not open input file")
+		}
+		efatal(err, "could not open input file")
+		defer f.Close()
+		in = bufio.NewReader(f)
+	}
 
-	flag.Parse()
+	if magic, _ := in.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(in)
+		efatalCode(exitParse, err, "could not read gzip input")
+		defer gz.Close()
+		in = bufio.NewReader(gz)
+	}
 
-	if *tableMode || *stripColNames || *asCSV {
-		mode = Matrix
+	if *fromCSV {
+		var text io.Reader = in
+		if enc != nil {
+			text = transform.NewReader(in, enc.NewDecoder())
+		}
+		xf, err := csvWorkbook(text, comma)
+		efatalCode(exitParse, err, "could not read input CSV")
+		return xf
 	}
-	if *statsMode {
-		mode = Stats
+	pass := *password
+	if pass == "" {
+		pass = os.Getenv("XL_PASSWORD")
 	}
-	if !*asJson && !*asGo && !*asCSV {
-		mode = Stats
+	return openWorkbook(in, pass)
+}
+
+// Open an Excel workbook, distinguishing encryption and legacy format failures from corrupt input
+func openWorkbook(in *bufio.Reader, password string) *xl.File {
+	// Encrypted workbooks are wrapped in an OLE compound file, as are legacy .xls workbooks
+	encrypted := false
+	if magic, _ := in.Peek(len(oleMagic)); bytes.Equal(magic, oleMagic) {
+		raw, err := io.ReadAll(in)
+		efatal(err, "could not read input")
+		if !bytes.Contains(raw, encryptionInfo) {
+			fatalCode(exitParse, "err: could not read input excel -> legacy .xls (BIFF) workbooks are not supported; re-save as .xlsx")
+		}
+		encrypted = true
+		in = bufio.NewReader(bytes.NewReader(raw))
 	}
 
-	if *inPath != "" {
-		f, err := os.Open(*inPath)
-		efatal(err, "could not open input file")
-		defer f.Close()
-		in = bufio.NewReader(f)
+	if head, _ := in.Peek(len(zipMagic) + 26 + len("mimetype") + len(odsMime)); isODS(head) {
+		raw, err := io.ReadAll(in)
+		efatal(err, "could not read input")
+		xf, err := odsWorkbook(raw)
+		efatalCode(exitParse, err, "could not read input ODS")
+		return xf
 	}
 
-	if *outPath != "" {
-		f, err := os.Create(*outPath)
-		efatal(err, "could not create output file")
-		defer f.Close()
-		out = bufio.NewWriter(f)
+	xf, err := xl.OpenReader(in, xl.Options{Password: password})
+	if err != nil && encrypted {
+		// A bad key yields garbage which then fails to unzip
+		badKey := strings.Contains(err.Error(), "decrypted file failed") || errors.Is(err, zip.ErrFormat)
+		switch {
+		case badKey && password == "":
+			fatalCode(exitEncryption, "err: could not read input excel -> workbook is encrypted; set -password or XL_PASSWORD")
+		case badKey:
+			fatalCode(exitEncryption, "err: could not read input excel -> wrong password for encrypted workbook")
+		}
 	}
+	efatalCode(exitParse, err, "could not read input excel")
+	return xf
+}
 
-	defer out.Flush()
+// Report whether a file starts like an OpenDocument spreadsheet: a zip whose first entry is the mimetype
+func isODS(head []byte) bool {
+	// The entry name follows the 30 byte local header, and its stored content follows the name
+	name := 30
+	return len(head) >= name+len("mimetype")+len(odsMime) &&
+		bytes.HasPrefix(head, zipMagic) &&
+		string(head[name:name+len("mimetype")]) == "mimetype" &&
+		bytes.Equal(head[name+len("mimetype"):name+len("mimetype")+len(odsMime)], odsMime)
+}
 
-	opts := xl.Options{}
-	xf, err := xl.OpenReader(in, opts)
-	efatal(err, "could not read input excel")
-	defer xf.Close()
+// Load the tables of an OpenDocument spreadsheet into an in-memory workbook so it flows through the Excel path
+// Cells hold their displayed text; repeated empty rows and cells are only kept when something follows them
+func odsWorkbook(raw []byte) (*xl.File, error) {
+	const (
+		tableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+		textNS   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+		officeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	)
 
-	sheets := xf.GetSheetList()
-	nSheets := 0
-	nRows := 0
-	nCols := 0
-	sheetFound := false
-	rowSize := 0
+	zr, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		return nil, err
+	}
+	content, err := zr.Open("content.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
 
-	for _, sheet := range sheets {
-		if *useSheet != "" && sheet != *useSheet {
-			continue
+	// Repeat counts default to 1
+	repeat := func(e xml.StartElement, name string) int {
+		for _, a := range e.Attr {
+			if a.Name.Space == tableNS && a.Name.Local == name {
+				if n, err := strconv.Atoi(a.Value); err == nil && n > 0 {
+					return n
+				}
+			}
 		}
-		sheetFound = true
-		bookTab[sheet] = make(map[string][]string)
-		bookMat[sheet] = [][]string{}
-		nSheets++
-		cols, err := xf.Cols(sheet)
-		efatal(err, "could not get columns for sheet", sheet)
+		return 1
+	}
 
-		for cols.Next() {
-			nCols++
-			col, err := cols.Rows()
-			// Might be erroneous for titled/nontitled mode
-			rowSize = len(col)
-			efatal(err, "could not get rows of col for sheet", sheet)
+	xf := xl.NewFile()
+	nSheets := 0
+	var rows [][]string
+	var row []string
+	emptyRows, emptyCells := 0, 0 // Empty rows and cells not yet known to be inside the table or row
+	rowRepeat, cellRepeat := 1, 1
+	var cell strings.Builder
+	inCell, paras, notes := false, 0, 0
 
-			switch mode {
-			case Map:
-				// Assumes we have a title
-				if len(col) < 1 {
-					// Column with NO title and NO values
-					fatal("can't use Map mode with no title or values; col #:", nCols-1, "sheet:", sheet)
-				} else if len(col) < 2 {
-					// Column with title and NO values (probably)
-					bookTab[sheet][col[0]] = []string{}
+	dec := xml.NewDecoder(content)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == officeNS && t.Name.Local == "annotation":
+				// Comments aren't cell text
+				notes++
+			case notes > 0:
+			case t.Name.Space == tableNS && t.Name.Local == "table":
+				rows, emptyRows = nil, 0
+				name := fmt.Sprint("Sheet", nSheets+1)
+				for _, a := range t.Attr {
+					if a.Name.Space == tableNS && a.Name.Local == "name" {
+						name = a.Value
+					}
+				}
+				if nSheets == 0 {
+					xf.SetSheetName(xf.GetSheetName(0), name)
 				} else {
-					// Column has title and values
-					bookTab[sheet][col[0]] = col[1:]
+					xf.NewSheet(name)
 				}
-			case Matrix:
-				// Table format across all sheets
-				bookMat[sheet] = append(bookMat[sheet], col)
-			default:
-				// Stats mode does nothing
+				nSheets++
+			case t.Name.Space == tableNS && t.Name.Local == "table-row":
+				row, emptyCells = nil, 0
+				rowRepeat = repeat(t, "number-rows-repeated")
+			case t.Name.Space == tableNS && (t.Name.Local == "table-cell" || t.Name.Local == "covered-table-cell"):
+				cell.Reset()
+				inCell, paras = true, 0
+				cellRepeat = repeat(t, "number-columns-repeated")
+			case inCell && t.Name.Space == textNS && t.Name.Local == "p":
+				if paras > 0 {
+					cell.WriteByte('\n')
+				}
+				paras++
+			case inCell && t.Name.Space == textNS && t.Name.Local == "s":
+				// Runs of spaces are stored as a count
+				n := 1
+				for _, a := range t.Attr {
+					if a.Name.Space == textNS && a.Name.Local == "c" {
+						if c, err := strconv.Atoi(a.Value); err == nil {
+							n = c
+						}
+					}
+				}
+				cell.WriteString(strings.Repeat(" ", n))
+			case inCell && t.Name.Space == textNS && t.Name.Local == "tab":
+				cell.WriteByte('\t')
+			case inCell && t.Name.Space == textNS && t.Name.Local == "line-break":
+				cell.WriteByte('\n')
 			}
-
-			for rowi, rowCell := range col {
-				if !*noColNames && rowi == 0 && len(strings.TrimSpace(rowCell)) > 0 {
-					if mode == Stats {
-						fmt.Fprintln(out, "Column name:", `"`+rowCell+`"`, "at col#", nCols-1, "with", len(col), "rows")
+		case xml.CharData:
+			if inCell && paras > 0 && notes == 0 {
+				cell.Write(t)
+			}
+		case xml.EndElement:
+			switch {
+			case t.Name.Space == officeNS && t.Name.Local == "annotation":
+				notes--
+			case notes > 0:
+			case t.Name.Space == tableNS && (t.Name.Local == "table-cell" || t.Name.Local == "covered-table-cell"):
+				inCell = false
+				if cell.Len() == 0 {
+					emptyCells += cellRepeat
+					break
+				}
+				for ; emptyCells > 0; emptyCells-- {
+					row = append(row, "")
+				}
+				for i := 0; i < cellRepeat; i++ {
+					row = append(row, cell.String())
+				}
+			case t.Name.Space == tableNS && t.Name.Local == "table-row":
+				if len(row) == 0 {
+					emptyRows += rowRepeat
+					break
+				}
+				for ; emptyRows > 0; emptyRows-- {
+					rows = append(rows, nil)
+				}
+				for i := 0; i < rowRepeat; i++ {
+					rows = append(rows, row)
+				}
+			case t.Name.Space == tableNS && t.Name.Local == "table":
+				sheet := xf.GetSheetName(nSheets - 1)
+				for ri := range rows {
+					if len(rows[ri]) == 0 {
+						continue
+					}
+					axis, err := xl.CoordinatesToCellName(1, ri+1)
+					if err != nil {
+						return nil, err
+					}
+					if err := xf.SetSheetRow(sheet, axis, &rows[ri]); err != nil {
+						return nil, err
 					}
 				}
-				nRows++
 			}
 		}
+	}
+	if nSheets == 0 {
+		return nil, fmt.Errorf("no tables found")
+	}
+	return xf, nil
+}
 
-		if !*allSheets {
-			break
+// Load CSV into a single-sheet in-memory workbook so it flows through the Excel path
+func csvWorkbook(in io.Reader, comma rune) (*xl.File, error) {
+	r := csv.NewReader(in)
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	xf := xl.NewFile()
+	sheet := xf.GetSheetName(0)
+	for ri, record := range records {
+		axis, err := xl.CoordinatesToCellName(1, ri+1)
+		if err != nil {
+			return nil, err
+		}
+		if err := xf.SetSheetRow(sheet, axis, &record); err != nil {
+			return nil, err
 		}
 	}
+	return xf, nil
+}
 
-	fmt.Fprintln(os.Stderr, "info: #sheets read:", nSheets, "#cols:", nCols, "#elements:", nRows, "#nrows:", rowSize)
+// Single-byte text encodings accepted by -encoding besides UTF-8
+var textEncodings = map[string]encoding.Encoding{
+	"windows-1250": charmap.Windows1250,
+	"windows-1251": charmap.Windows1251,
+	"windows-1252": charmap.Windows1252,
+	"latin1":       charmap.ISO8859_1,
+	"iso-8859-1":   charmap.ISO8859_1,
+	"iso-8859-15":  charmap.ISO8859_15,
+	"macintosh":    charmap.Macintosh,
+	"ibm437":       charmap.CodePage437,
+}
 
-	if !sheetFound {
-		fatal("could not find sheet by name of:", *useSheet)
+// Encoding by -encoding name; nil for UTF-8, which needs no transformation
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	name = strings.ToLower(name)
+	if name == "utf-8" || name == "utf8" {
+		return nil, nil
 	}
+	if enc, ok := textEncodings[name]; ok {
+		return enc, nil
+	}
+	names := []string{"utf-8"}
+	for n := range textEncodings {
+		names = append(names, n)
+	}
+	sort.Strings(names[1:])
+	return nil, fmt.Errorf("unknown encoding %q; supported: %s", name, strings.Join(names, ", "))
+}
 
-	// JSON mode
-	if *asJson {
-		enc := json.NewEncoder(out)
-		switch mode {
-		case Matrix:
-			efatal(enc.Encode(bookMat), "could not JSON encode")
-		case Map:
-			efatal(enc.Encode(bookTab), "could not JSON encode")
-		}
+// Writer encoding UTF-8 text written to w as enc; characters enc lacks are replaced
+func encodeText(w io.Writer, enc encoding.Encoding) io.Writer {
+	if enc == nil {
+		return w
+	}
+	return encoding.ReplaceUnsupported(enc.NewEncoder()).Writer(w)
+}
 
-		return
+// Workbook as emitted by -xml
+type xmlBook struct {
+	XMLName xml.Name   `xml:"book"`
+	Sheets  []xmlSheet `xml:"sheet"`
+}
+
+type xmlSheet struct {
+	Name string   `xml:"name,attr"`
+	Rows []xmlRow `xml:"row"`
+}
+
+type xmlRow struct {
+	Cells []xmlCell `xml:"cell"`
+}
+
+// Cell named by its column in Map mode, positional in Matrix mode
+type xmlCell struct {
+	Name  string `xml:"name,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// Sheet as read by a -jobs worker, before it's added to the book
+type sheetRead struct {
+	mat      [][]string
+	notes    bytes.Buffer         // Output preceding the sheet's in Stats mode
+	links    map[string]hyperlink // Hyperlinked cells of JSON output by placeholder
+	targets  map[cellPos]string   // Link targets of hyperlinked cells, for rendering after the row filters
+	comments map[string]string
+	styles   map[string]cellStyle
+	sparse   map[string]string // Non-empty cells by address, for -sparse
+	errors   []string          // Addresses of error cells
+	titles   map[string]string // Original titles by -snake key
+	bools    []string          // Titles of columns normalized by -bool-as
+	nCols    int               // Columns read across inputs
+	cols     int               // Columns of the sheet
+	elems    int
+	rowSize  int
+	took     time.Duration
+}
+
+// Distinct values of a column as reported by -count-distinct
+type distinctInfo struct {
+	Count  int      `json:"count"`
+	Values []string `json:"values,omitempty"` // Sorted, with -list-distinct
+}
+
+// SHA-256 of a sheet's rows as hex, ignoring empty cells and rows at their ends so unused formatted cells don't count
+func sheetChecksum(rows [][]string) string {
+	for len(rows) > 0 && strings.Join(rows[len(rows)-1], "") == "" {
+		rows = rows[:len(rows)-1]
+	}
+	h := sha256.New()
+	for _, row := range rows {
+		for len(row) > 0 && row[len(row)-1] == "" {
+			row = row[:len(row)-1]
+		}
+		// Cells are length-prefixed so their boundaries are unambiguous
+		for _, cell := range row {
+			fmt.Fprintf(h, "%d:%s", len(cell), cell)
+		}
+		h.Write([]byte{'\n'})
 	}
+	return hex.EncodeToString(h.Sum(nil))
+}
 
-	// Go syntax mode
-	if *asGo {
-		switch mode {
-		case Matrix:
-			fmt.Fprintf(out, "%#v\n", bookMat)
-		case Map:
-			fmt.Fprintf(out, "%#v\n", bookTab)
+// Sorted unique values of a column; empty cells are one value unless ignored
+func distinctValues(col []string, ignoreEmpty bool) []string {
+	seen := make(map[string]bool)
+	values := []string{}
+	for _, cell := range col {
+		if seen[cell] || (cell == "" && ignoreEmpty) {
+			continue
 		}
+		seen[cell] = true
+		values = append(values, cell)
+	}
+	sort.Strings(values)
+	return values
+}
 
-		return
+// Sheet dimensions as reported by -list and -count
+type sheetInfo struct {
+	Name string `json:"name,omitempty"`
+	Rows int    `json:"rows"`
+	Cols int    `json:"cols"`
+}
+
+// Read a sheet row by row, passing the title row and then each kept data row to emit
+// Supports the row features needing no look-ahead: -trim, -columns, -fill-down, -drop-empty-rows, -where, and -head
+// Returns the number of data rows emitted
+func streamRows(xf *xl.File, sheet string, wantCols []string, preds []predicate, keep, drop *regexp.Regexp, limit int, emit func(row []string, title bool) error) (int, error) {
+	rows, err := xf.Rows(sheet)
+	if err != nil {
+		return 0, err
 	}
+	defer rows.Close()
 
-	// CSV mode
-	if *asCSV {
-		// Implicitly matrix mode
-		w := csv.NewWriter(out)
-		defaultSheet := sheets[0]
-		// fmt.Println(defaultSheet)
-		var tab [][]string
-		records := bookMat[defaultSheet]
-		nCols := len(records)
-		var nRows int = 0
-		for ci := 0; ci < nCols; ci++ {
-			if len(records[ci]) > nRows {
-				nRows = len(records[ci])
+	var title []string
+	var pick, fillIdx, predIdx []int
+	var last []string // Last non-empty value of each -fill-down column
+	var sample *reservoir
+	if *sampleRows > 0 {
+		sample = newReservoir(*sampleRows, *seed)
+	}
+	most := *headRows // Data rows to emit; 0 is unlimited
+	if limit > 0 && (most == 0 || limit < most) {
+		most = limit
+	}
+	n := 0
+	for rows.Next() {
+		if most > 0 && n >= most && sample == nil {
+			break
+		}
+		row, err := rows.Columns(xl.Options{RawCellValue: *rawValues})
+		if err != nil {
+			return n, err
+		}
+		if *trim {
+			for i := range row {
+				row[i] = strings.TrimSpace(row[i])
 			}
 		}
-
-		tab = make([][]string, nRows)
-		for i := 0; i < len(tab); i++ {
-			tab[i] = make([]string, nCols)
+		if *maxCellLen > 0 {
+			for i := range row {
+				row[i] = truncateCell(row[i], *maxCellLen, *truncMarker)
+			}
 		}
 
-		for ci := 0; ci < len(records); ci++ {
-			for ri := 0; ri < len(records[ci]); ri++ {
-				if *noColNames && ri == 0 {
-					continue
+		if title == nil && !*noColNames {
+			title = row
+			for _, col := range wantCols {
+				ci := indexOf(title, col)
+				if ci < 0 {
+					return n, fmt.Errorf("no column named %q", col)
+				}
+				pick = append(pick, ci)
+			}
+			for _, col := range fills {
+				ci := indexOf(title, col)
+				if ci < 0 {
+					return n, fmt.Errorf("no column named %q", col)
+				}
+				fillIdx = append(fillIdx, ci)
+			}
+			last = make([]string, len(fillIdx))
+			for _, p := range preds {
+				ci := indexOf(title, p.col)
+				if ci < 0 {
+					return n, fmt.Errorf("no column named %q", p.col)
 				}
-				tab[ri][ci] = records[ci][ri]
+				predIdx = append(predIdx, ci)
+			}
+			if err := emit(project(title, pick), true); err != nil {
+				return n, err
 			}
+			continue
 		}
-		err := w.WriteAll(tab)
-		efatal(err, "could not write output CSV")
 
-		return
+		for len(row) < len(title) {
+			row = append(row, "")
+		}
+		if *dropEmptyRows && strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		for i, ci := range fillIdx {
+			if row[ci] == "" {
+				row[ci] = last[i]
+			} else {
+				last[i] = row[ci]
+			}
+		}
+		kept := true
+		for pi, p := range preds {
+			if !p.match(row[predIdx[pi]]) {
+				kept = false
+				break
+			}
+		}
+		if !kept || !grepRow(row, keep, drop) {
+			continue
+		}
+
+		if sample != nil {
+			sample.offer(project(row, pick))
+			continue
+		}
+		if err := emit(project(row, pick), *noColNames && n == 0 && title == nil); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Error(); err != nil || sample == nil {
+		return n, err
+	}
+
+	for _, row := range sample.rows() {
+		if most > 0 && n >= most {
+			break
+		}
+		if err := emit(row, *noColNames && n == 0); err != nil {
+			return n, err
+		}
+		n++
 	}
+	return n, nil
 }
 
-func efatal(err error, s ...any) {
-	if err == nil {
+// Uniform random sample of a fixed number of rows from a stream of unknown length
+type reservoir struct {
+	size  int
+	seen  int
+	kept  [][]string
+	order []int // Position in the stream of each kept row
+	rng   *rand.Rand
+}
+
+// Reservoir of size rows; seed 0 picks a different sample every run
+func newReservoir(size int, seed int64) *reservoir {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &reservoir{size: size, rng: rand.New(rand.NewSource(seed))}
+}
+
+func (r *reservoir) offer(row []string) {
+	r.seen++
+	if len(r.kept) < r.size {
+		r.kept = append(r.kept, row)
+		r.order = append(r.order, r.seen)
 		return
 	}
-	var msg []any = []any{"err:"}
-	msg = append(msg, s...)
-	msg = append(msg, "->", err.Error())
-	fatal(msg...)
+	if i := r.rng.Intn(r.seen); i < r.size {
+		r.kept[i], r.order[i] = row, r.seen
+	}
 }
 
-func fatal(s ...any) {
+// Sampled rows in the order they were offered
+func (r *reservoir) rows() [][]string {
+	idx := make([]int, len(r.kept))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(a, b int) bool { return r.order[idx[a]] < r.order[idx[b]] })
+
+	rows := make([][]string, len(idx))
+	for i, k := range idx {
+		rows[i] = r.kept[k]
+	}
+	return rows
+}
+
+// Cut s to its first n runes followed by marker, if it's any longer
+func truncateCell(s string, n int, marker string) string {
+	if len(s) <= n {
+		return s
+	}
+	for i := range s {
+		if n == 0 {
+			return s[:i] + marker
+		}
+		n--
+	}
+	return s
+}
+
+// Cells of row at the given positions, or the whole row if there are none
+func project(row []string, pick []int) []string {
+	if pick == nil {
+		return row
+	}
+	picked := make([]string, len(pick))
+	for i, ci := range pick {
+		picked[i] = row[ci]
+	}
+	return picked
+}
+
+// Count the rows of a sheet and its widest row by streaming, without keeping cells
+func sheetSize(xf *xl.File, sheet string) (sheetInfo, error) {
+	info := sheetInfo{Name: sheet}
+	rows, err := xf.Rows(sheet)
+	if err != nil {
+		return info, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row, err := rows.Columns()
+		if err != nil {
+			return info, err
+		}
+		info.Rows++
+		if len(row) > info.Cols {
+			info.Cols = len(row)
+		}
+	}
+	return info, rows.Error()
+}
+
+// Repeatable string flag
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+var (
+	headers listFlag
+	wheres  listFlag
+	aggs    listFlag
+	fills   listFlag
+)
+
+func init() {
+	flag.Var(&headers, "header", "HTTP header as 'Name: value' to send when -i is a URL; may be repeated")
+	flag.Var(&aggs, "agg", "Aggregate COL:FUNC per -group-by group, FUNC being sum, avg, min, max, or count; may be repeated")
+	flag.Var(&fills, "fill-down", "Fill empty cells of the named column with the last value above them; may be repeated")
+	flag.Var(&wheres, "where", "Only keep rows matching COL=VALUE, COL!=VALUE, or COL~REGEX; may be repeated to require all")
+}
+
+func main() {
+	mode := Map                                         // Used in Matrix mode
+	bookTab := make(map[string]map[string][]string)     // If using all sheets and table format per-sheet
+	bookMat := make(map[string][][]string)              // If using all sheets 2D matrix format per-sheet
+	bookCols := make(map[string][]string)               // Column names per-sheet, in sheet order
+	bookStats := make(map[string]*sheetStats)           // Per-sheet column statistics in Stats mode
+	bookLinks := make(map[string]hyperlink)             // Hyperlinked cells of JSON output by the placeholder standing in for them
+	bookComments := make(map[string]map[string]string)  // Per-sheet cell comments by address
+	bookStyles := make(map[string]map[string]cellStyle) // Per-sheet non-default cell styles by address
+	bookSparse := make(map[string]map[string]string)    // Per-sheet non-empty cells by address, for -sparse
+	bookTitles := make(map[string]map[string]string)    // Per-sheet original titles by their -snake form
+	bookErrors := make(map[string][]string)             // Per-sheet addresses of cells holding error values
+	bookBools := make(map[string]map[string]bool)       // Sheet→titles of columns normalized by -bool-as
+	var bookSheets []string                             // Sheets read, in workbook order
+
+	out := bufio.NewWriter(os.Stdout)
+
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println("xl", version, "excelize", excelizeVersion())
+		return
+	}
+
+	manySheets := *allSheets || *sheetList != "" || *sheetMatch != "" // Output is keyed per-sheet
+	if *protoSafe {
+		// Proto field names are a stricter snake_case
+		*snakeTitles = true
+	}
+
+	if *tableMode || *stripColNames || *asCSV || *asTSV || *asPretty || *asMarkdown || *asHTML || *asXLSX {
+		mode = Matrix
+	}
+	if *statsMode {
+		mode = Stats
+	}
+	if !*asJson && !*asRecords && !*asNDJSON && !*asGo && !*asGoStruct && !*asYAML && !*asTOML && !*asXML && !*asJSONSchema && !*asSQL && *templatePath == "" && !*asCSV && !*asTSV && !*asPretty && !*asMarkdown && !*asHTML && !*asXLSX && !*asSparse && !*asFlat {
+		mode = Stats
+	}
+	if *countDistinct != "" || *asSparse || *checksum {
+		// Distinct values, sparse cells, and checksums come from the whole columns
+		mode = Matrix
+	}
+	if *checksum {
+		// Number formats are cosmetic
+		*rawValues = true
+	}
+
+	if *split {
+		if *outPath == "" {
+			fatal("-split requires -o naming a directory or a path containing {sheet}")
+		}
+		if mode == Stats && !*asJson {
+			fatal("-split requires an output format")
+		}
+	}
+	if *withStyles && !*asJson {
+		fatal("-styles requires -json output")
+	}
+	if *asXLSX && *outPath == "" && *appendTo == "" {
+		fatal("xlsx output requires an output file set with -o or -append-to")
+	}
+	if *appendTo != "" && (!*asXLSX || *outPath != "" || *split) {
+		fatal("-append-to adds sheets to a workbook with -xlsx output; can't be used with -o or -split")
+	}
+	if *overwriteSheet && *appendTo == "" {
+		fatal("-overwrite-sheet requires -append-to")
+	}
+	if *newSheetName != "" && (!*asXLSX || manySheets) {
+		fatal("-sheet-name names the one sheet of -xlsx output")
+	}
+	if *useSheet != "" && *sheetIndex >= 0 {
+		fatal("-sheet and -sheet-index are mutually exclusive")
+	}
+	if *flatten && (!manySheets || *joinSheets != "") {
+		fatal("-flatten stacks many sheets; it needs -all, -sheets, or -sheet-match and can't be used with -join-sheets")
+	}
+	if *withIndex && (*groupBy != "" || *pivot || *checksum) {
+		fatal("-with-index numbers sheet rows; can't be used with -group-by, -pivot, or -checksum")
+	}
+	if *sheetCol != "" && !*flatten {
+		fatal("-sheet-col requires -flatten")
+	}
+	if *mergeHeaders < 0 {
+		fatal("-merge-headers must not be negative:", *mergeHeaders)
+	}
+	if *mergeHeaders > 1 && (*noColNames || *alphaKeys) {
+		fatal("-merge-headers merges title rows; can't be used with -notitles or -alpha-keys")
+	}
+	if *alphaKeys && *noColNames {
+		fatal("-alpha-keys titles columns by letter; can't be used with -notitles")
+	}
+	if *definedName != "" && (*cellRange != "" || *useSheet != "" || *sheetIndex >= 0 || manySheets || *joinSheets != "") {
+		fatal("-name selects its own sheet and range; can't be used with -range or other sheet selection")
+	}
+	if *firstSheet && (*useSheet != "" || *sheetIndex >= 0 || manySheets) {
+		fatal("-first can't be combined with other sheet selection")
+	}
+	if *pickSheet && (*useSheet != "" || *sheetIndex >= 0 || manySheets || *firstSheet || *definedName != "") {
+		fatal("-interactive can't be combined with other sheet selection")
+	}
+	if *sheetList != "" && (*useSheet != "" || *sheetIndex >= 0) {
+		fatal("-sheets can't be combined with -sheet or -sheet-index")
+	}
+	var sheetRe *regexp.Regexp
+	if *sheetMatch != "" {
+		if *useSheet != "" || *sheetIndex >= 0 {
+			fatal("-sheet-match can't be combined with -sheet or -sheet-index")
+		}
+		var err error
+		sheetRe, err = regexp.Compile(*sheetMatch)
+		efatalCode(exitParse, err, "invalid -sheet-match regular expression")
+	}
+	var expectCols []string
+	if *expectList != "" {
+		if *noColNames {
+			fatal("-expect-cols checks column names; can't be used with -notitles")
+		}
+		expectCols = strings.Split(*expectList, ",")
+	}
+	var wantCols []string
+	if *colList != "" {
+		if *noColNames {
+			fatal("-columns selects by column name; can't be used with -notitles")
+		}
+		wantCols = strings.Split(*colList, ",")
+	}
+	comma, size := utf8.DecodeRuneInString(*delimiter)
+	if size != len(*delimiter) || size != 1 || comma == '"' || comma == '\r' || comma == '\n' {
+		fatal("delimiter must be a single ASCII character other than a quote or newline; got:", strconv.Quote(*delimiter))
+	}
+	textEnc, encErr := lookupEncoding(*encodingName)
+	efatal(encErr, "invalid -encoding")
+	if textEnc != nil {
+		if !*fromCSV && !*asCSV && !*asTSV {
+			fatal("-encoding applies only to -from-csv input and -csv or -tsv output")
+		}
+		if *bom {
+			fatal("-bom marks UTF-8 output; can't be used with -encoding", *encodingName)
+		}
+	}
+
+	layout := "2006-01-02" // Used by -dates
+	switch {
+	case *dateLayout != "":
+		layout = *dateLayout
+	case *dateTimes:
+		layout = time.RFC3339
+	}
+
+	var preds []predicate
+	for _, w := range wheres {
+		if *noColNames {
+			fatal("-where filters by column name; can't be used with -notitles")
+		}
+		p, err := parsePredicate(w)
+		efatalCode(exitParse, err, "could not parse -where")
+		preds = append(preds, p)
+	}
+
+	var grepRe, grepVRe *regexp.Regexp
+	if *grepPat != "" {
+		var err error
+		grepRe, err = regexp.Compile(*grepPat)
+		efatalCode(exitParse, err, "invalid -grep regular expression")
+	}
+	if *grepVPat != "" {
+		var err error
+		grepVRe, err = regexp.Compile(*grepVPat)
+		efatalCode(exitParse, err, "invalid -grep-v regular expression")
+	}
+
+	sortCol, sortDesc := *sortBy, false
+	if *sortBy != "" {
+		if *noColNames {
+			fatal("-sort orders by column name; can't be used with -notitles")
+		}
+		if strings.HasSuffix(*sortBy, ":desc") {
+			sortCol, sortDesc = strings.TrimSuffix(*sortBy, ":desc"), true
+		} else {
+			sortCol = strings.TrimSuffix(*sortBy, ":asc")
+		}
+	}
+
+	var dedupCols []string
+	if *dedupOn != "" {
+		if *noColNames {
+			fatal("-dedup-on selects by column name; can't be used with -notitles")
+		}
+		dedupCols = strings.Split(*dedupOn, ",")
+	}
+	dedup := *dedupRows || dedupCols != nil
+
+	var joinNames []string // Left and right sheet of a join
+	if *joinSheets != "" {
+		joinNames = strings.Split(*joinSheets, ",")
+		switch {
+		case len(joinNames) != 2 || joinNames[0] == "" || joinNames[1] == "":
+			fatal("-join-sheets takes exactly two sheet names:", *joinSheets)
+		case *joinOn == "":
+			fatal("-join-sheets requires a key column set with -join-on")
+		case *noColNames:
+			fatal("-join-sheets joins by column name; can't be used with -notitles")
+		case manySheets || *useSheet != "" || *sheetIndex >= 0:
+			fatal("-join-sheets can't be combined with other sheet selection")
+		}
+	}
+	if *joinType != "inner" && *joinType != "left" {
+		fatal("unknown -join-type:", *joinType)
+	}
+
+	switch *boolAs {
+	case "", "json", "yesno", "10":
+	default:
+		fatal("unknown -bool-as format:", *boolAs)
+	}
+	var renames map[string]string // New titles by old
+	var renameOrder []string
+	if *renameCols != "" {
+		if *noColNames {
+			fatal("-rename-cols renames column titles; can't be used with -notitles")
+		}
+		renames = make(map[string]string)
+		for _, pair := range strings.Split(*renameCols, ",") {
+			old, name, ok := strings.Cut(pair, "=")
+			if !ok || old == "" {
+				fatalCode(exitParse, "malformed -rename-cols pair", `"`+pair+`";`, "expected OLD=NEW")
+			}
+			renames[old] = name
+			renameOrder = append(renameOrder, old)
+		}
+	}
+	if *textCols != "" && *noColNames {
+		fatal("-text-columns selects by column name; can't be used with -notitles")
+	}
+	if len(fills) > 0 && *noColNames {
+		fatal("-fill-down selects by column name; can't be used with -notitles")
+	}
+
+	var aggregates []aggregate
+	if *groupBy != "" && *noColNames {
+		fatal("-group-by groups by column name; can't be used with -notitles")
+	}
+	if len(aggs) > 0 && *groupBy == "" {
+		fatal("-agg requires -group-by")
+	}
+	for _, a := range aggs {
+		agg, err := parseAggregate(a)
+		efatalCode(exitParse, err, "could not parse -agg")
+		aggregates = append(aggregates, agg)
+	}
+
+	var pivotAgg aggregate
+	if *pivot {
+		switch {
+		case *noColNames:
+			fatal("-pivot uses columns by name; can't be used with -notitles")
+		case *groupBy != "":
+			fatal("-pivot and -group-by are mutually exclusive")
+		case *pivotRowCol == "" || *pivotColCol == "" || *pivotValCol == "":
+			fatal("-pivot requires -pivot-rows, -pivot-cols, and -pivot-val")
+		}
+		var err error
+		pivotAgg, err = parseAggregate(*pivotValCol + ":" + *pivotAggFn)
+		efatalCode(exitParse, err, "could not parse -pivot-agg")
+	} else if *pivotRowCol != "" || *pivotColCol != "" || *pivotValCol != "" {
+		fatal("-pivot-rows, -pivot-cols, and -pivot-val require -pivot")
+	}
+
+	var area *cellArea
+	if *cellRange != "" {
+		a, err := parseCellRange(*cellRange)
+		efatalCode(exitParse, err, "could not parse -range")
+		area = &a
+	}
+	if *skipRows < 0 {
+		fatal("-skip-rows must not be negative:", *skipRows)
+	}
+	if *skipRows > 0 {
+		// Skipping rows narrows the area read, whether the whole sheet or a range
+		if area == nil {
+			area = &cellArea{1, 1, xl.TotalColumns, xl.TotalRows}
+		}
+		area.r1 += *skipRows
+	}
+	if *colRange != "" {
+		lo, hi, err := parseColRange(*colRange)
+		efatalCode(exitParse, err, "could not parse -col-range")
+		// Columns narrow the area read, whether the whole sheet or a range
+		if area == nil {
+			area = &cellArea{1, 1, xl.TotalColumns, xl.TotalRows}
+		}
+		if lo > area.c1 {
+			area.c1 = lo
+		}
+		if hi < area.c2 {
+			area.c2 = hi
+		}
+		if area.c1 > area.c2 {
+			fatal("-col-range", *colRange, "has no columns within -range", *cellRange)
+		}
+	}
+
+	rowStart, rowEnd := 1, 0 // 0 means no upper bound
+	if *rowRange != "" {
+		var err error
+		rowStart, rowEnd, err = parseRowRange(*rowRange)
+		efatalCode(exitParse, err, "could not parse -rows")
+		if rowEnd != 0 && rowEnd < rowStart {
+			notice("warn: -rows range", *rowRange, "is inverted; no data rows will be output")
+		}
+	}
+	if *headRows > 0 && *tailRows > 0 {
+		fatal("-head and -tail are mutually exclusive")
+	}
+	if utf8.RuneCountInString(*decimalSep) != 1 || utf8.RuneCountInString(*thousandsSep) > 1 || *decimalSep == *thousandsSep {
+		fatal("-decimal-sep must be one character and -thousands-sep at most one, and they must differ")
+	}
+	if *countDistinct != "" && *noColNames {
+		fatal("-count-distinct finds its column by name; can't be used with -notitles")
+	}
+	if (*listDistinct || *ignoreEmpty) && *countDistinct == "" {
+		fatal("-list-distinct and -ignore-empty require -count-distinct")
+	}
+	if *asSparse {
+		// Cells keep their sheet addresses, so rows can't move or be dropped
+		moved := map[string]bool{
+			"-where": len(wheres) > 0, "-grep": *grepPat != "" || *grepVPat != "", "-sort": *sortBy != "", "-group-by": *groupBy != "",
+			"-pivot": *pivot, "-transpose": *transpose, "-dedup": *dedupRows || *dedupOn != "", "-sample": *sampleRows > 0,
+			"-head": *headRows > 0, "-tail": *tailRows > 0, "-rows": *rowRange != "", "-limit": *rowLimit > 0,
+			"-drop-empty-rows": *dropEmptyRows, "-fill-down": len(fills) > 0, "-flatten": *flatten, "-join-sheets": *joinSheets != "",
+		}
+		if name := firstSet(moved); name != "" {
+			fatal(name, "can't be used with -sparse")
+		}
+	}
+	var castCols []string                // Columns given to -cast, in order
+	castTypes := make(map[string]string) // -cast type of each column
+	if *castList != "" {
+		if mode != Map || (!*asJson && !*asRecords && !*asNDJSON && !*asFlat) {
+			fatal("-cast requires Map mode -json, -records, -ndjson, or -flat output")
+		}
+		var err error
+		castCols, castTypes, err = parseCasts(*castList)
+		efatalCode(exitParse, err, "could not parse -cast")
+	}
+	if *asFlat && *noColNames {
+		fatal("flat output requires column names; can't be used with -notitles")
+	}
+	if *flatPrefix != "" && !*asFlat {
+		fatal("-prefix requires -flat")
+	}
+	if *keyOrder != "original" && *keyOrder != "sorted" {
+		fatal("-order must be original or sorted; got:", *keyOrder)
+	}
+	if *maxCellLen < 0 {
+		fatal("-max-cell-length must not be negative:", *maxCellLen)
+	}
+	if *sampleRows < 0 {
+		fatal("-sample must not be negative:", *sampleRows)
+	}
+	if *rowLimit < 0 {
+		fatal("-limit must not be negative:", *rowLimit)
+	}
+	if *headRows < 0 || *tailRows < 0 {
+		fatal("-head and -tail must not be negative")
+	}
+	if *maxWidth < 0 || *maxWidth == 1 {
+		fatal("-max-width must be 0 or at least 2:", *maxWidth)
+	}
+	if *indent < 0 {
+		fatal("indent must not be negative:", *indent)
+	}
+	if *stream {
+		if !*asCSV && !*asTSV && !*asNDJSON {
+			fatal("-stream requires -csv, -tsv, or -ndjson output")
+		}
+		if *asNDJSON && *noColNames {
+			fatal("ndjson output requires column names; can't be used with -notitles")
+		}
+		// These need whole sheets or cell addresses
+		whole := map[string]bool{
+			"-transpose": *transpose, "-sort": *sortBy != "", "-group-by": *groupBy != "", "-pivot": *pivot, "-join-sheets": *joinSheets != "",
+			"-tail": *tailRows > 0, "-dedup": *dedupRows || *dedupOn != "", "-drop-empty-cols": *dropEmptyCols || *dropTitledEmpty,
+			"-rows": *rowRange != "", "-range": *cellRange != "", "-name": *definedName != "", "-col-range": *colRange != "", "-alpha-keys": *alphaKeys, "-merge-headers": *mergeHeaders > 1, "-flatten": *flatten, "-expect-cols": *expectList != "", "-dry-run": *dryRun, "-count-distinct": *countDistinct != "", "-cast": *castList != "", "-checksum": *checksum, "-skip-rows": *skipRows > 0, "-unmerge": *unmerge, "-eval": *evalFormulas, "-hyperlinks": *hyperlinks, "-comments": *withComments, "-styles": *withStyles,
+			"-dates": *dates || *dateTimes || *dateLayout != "", "-snake": *snakeTitles, "-source-col": *sourceCol != "", "-with-index": *withIndex, "-fail-on-errors": *failOnErrors, "-split": *split, "-bool-as": *boolAs != "", "-null-as": *nullAs != "empty", "-rename-cols": *renameCols != "",
+		}
+		if name := firstSet(whole); name != "" {
+			fatal(name, "can't be used with -stream")
+		}
+	}
+	if *jobs < 1 {
+		fatal("-jobs must be at least 1:", *jobs)
+	}
+	if *quiet && *verbose {
+		fatal("-quiet and -verbose are mutually exclusive")
+	}
+	if *keepOriginal && !*snakeTitles {
+		fatal("-keep-original requires -snake")
+	}
+	if *printMapping && !*snakeTitles {
+		fatal("-print-mapping requires -snake or -proto-safe")
+	}
+	var tmpl *template.Template
+	if *templatePath != "" {
+		if *noColNames {
+			fatal("template output requires column names; can't be used with -notitles")
+		}
+		var err error
+		tmpl, err = template.New(filepath.Base(*templatePath)).Funcs(templateFuncs).ParseFiles(*templatePath)
+		efatalCode(exitParse, err, "could not parse template")
+	}
+	if *asJSONSchema && *noColNames {
+		fatal("JSON Schema output requires column names; can't be used with -notitles")
+	}
+	if *asRecords && *noColNames {
+		fatal("records output requires column names; can't be used with -notitles")
+	}
+	if *goPackage != "" && !token.IsIdentifier(*goPackage) {
+		fatal("-go-package is not a valid Go identifier:", *goPackage)
+	}
+	if *goVar != "" && !token.IsIdentifier(*goVar) {
+		fatal("-go-var is not a valid Go identifier:", *goVar)
+	}
+	if *goPackage != "" && *goVar == "" {
+		*goVar = "Book"
+	}
+	if *asGoStruct && *noColNames {
+		fatal("Go struct output requires column names; can't be used with -notitles")
+	}
+	if *asSQL && *noColNames {
+		fatal("SQL output requires column names; can't be used with -notitles")
+	}
+
+	// Trailing arguments are more inputs whose sheets are combined with those of the first
+	inputs := flag.Args()
+	if *inPath != "" || len(inputs) < 1 {
+		inputs = append([]string{*inPath}, inputs...)
+	}
+	if *asSparse && len(inputs) > 1 {
+		fatal("-sparse keeps cells at their addresses; it reads a single input")
+	}
+	var books []*xl.File
+	for _, path := range inputs {
+		xf := loadWorkbook(path, comma, textEnc)
+		defer xf.Close()
+		books = append(books, xf)
+	}
+	xf := books[0]
+
+	var dst io.Writer = os.Stdout
+	if *dryRun {
+		dst = io.Discard
+	} else if *outPath != "" && !*split {
+		f, err := os.Create(*outPath)
+		efatal(err, "could not create output file")
+		defer f.Close()
+		dst = f
+	}
+	if (*gzipOut || strings.HasSuffix(*outPath, ".gz")) && !*split && !*dryRun {
+		gz := gzip.NewWriter(dst)
+		// Closing writes the gzip trailer, after the output is flushed
+		defer func() {
+			efatal(gz.Close(), "could not write gzip output")
+		}()
+		dst = gz
+	}
+	out = bufio.NewWriter(dst)
+
+	defer out.Flush()
+
+	var err error
+
+	sheets := xf.GetSheetList()
+
+	if *listSheets {
+		var infos []sheetInfo
+		for _, sheet := range sheets {
+			info, err := sheetSize(xf, sheet)
+			efatal(err, "could not get rows for sheet", sheet)
+			infos = append(infos, info)
+		}
+
+		if *asJson {
+			efatal(jsonEncoder(out, *indent).Encode(infos), "could not JSON encode")
+			return
+		}
+		for _, info := range infos {
+			fmt.Fprintf(out, "%s\t%d\t%d\n", info.Name, info.Rows, info.Cols)
+		}
+		return
+	}
+	if *sheetIndex >= len(sheets) {
+		fatalCode(exitNoSheet, "sheet index", *sheetIndex, "out of range; workbook has", len(sheets), "sheets")
+	}
+	if *sheetIndex >= 0 {
+		*useSheet = sheets[*sheetIndex]
+	}
+	if *definedName != "" {
+		sheet, a, err := definedRange(xf, *definedName)
+		efatalCode(exitNoSheet, err, "could not resolve -name")
+		if area != nil {
+			// -skip-rows and -col-range narrow the named range as they would the whole sheet
+			a.r1 += area.r1 - 1
+			if area.c1 > a.c1 {
+				a.c1 = area.c1
+			}
+			if area.c2 < a.c2 {
+				a.c2 = area.c2
+			}
+			if a.c1 > a.c2 {
+				fatal("-col-range", *colRange, "has no columns within -name", *definedName)
+			}
+		}
+		*useSheet, area = sheet, &a
+	}
+	if *useSheet == "" && !*firstSheet && !manySheets && joinNames == nil {
+		// Default to the sheet the workbook opens on
+		if active := xf.GetSheetName(xf.GetActiveSheetIndex()); active != "" {
+			*useSheet = active
+		}
+		if *pickSheet && len(sheets) > 1 && isTerminal(os.Stdin) {
+			*useSheet = promptSheet(sheets, *useSheet)
+		}
+	}
+
+	selected := sheets
+	if *sheetList != "" {
+		exists := make(map[string]bool)
+		for _, sheet := range sheets {
+			exists[sheet] = true
+		}
+
+		selected = nil
+		var missing []string
+		for _, sheet := range strings.Split(*sheetList, ",") {
+			if sheet == "" {
+				continue
+			}
+			if !exists[sheet] {
+				missing = append(missing, sheet)
+			}
+			selected = append(selected, sheet)
+		}
+		if len(missing) > 0 {
+			fatalCode(exitNoSheet, "could not find sheets by name of:", strings.Join(missing, ", "))
+		}
+	}
+	if sheetRe != nil {
+		var matched []string
+		for _, sheet := range selected {
+			if sheetRe.MatchString(sheet) {
+				matched = append(matched, sheet)
+			}
+		}
+		if len(matched) < 1 {
+			fatalCode(exitNoSheet, "no sheets match:", *sheetMatch)
+		}
+		selected = matched
+	}
+	if joinNames != nil {
+		for _, name := range joinNames {
+			if indexOf(sheets, name) < 0 {
+				fatalCode(exitNoSheet, "could not find sheet by name of:", name)
+			}
+		}
+		selected = joinNames
+	}
+	// Store a processed column-major sheet in the book for the chosen mode
+	addSheet := func(sheet string, mat [][]string) {
+		switch mode {
+		case Map:
+			for ci, col := range mat {
+				// Assumes we have a title
+				if len(col) < 1 {
+					// Column with NO title and NO values
+					fatal("can't use Map mode with no title or values; col #:", ci, "sheet:", sheet)
+				}
+				title := col[0]
+				if prev, ok := bookTab[sheet][title]; ok {
+					if *dupMerge {
+						notice("warn: duplicate column title", `"`+title+`"`, "at col #:", ci, "sheet:", sheet, "-> values appended")
+						bookTab[sheet][title] = append(prev, col[1:]...)
+						continue
+					}
+					title = uniqueTitle(bookTab[sheet], title)
+					notice("warn: duplicate column title", `"`+col[0]+`"`, "at col #:", ci, "sheet:", sheet, "-> renamed to", `"`+title+`"`)
+				}
+				bookCols[sheet] = append(bookCols[sheet], title)
+				if len(col) < 2 {
+					// Column with title and NO values (probably)
+					bookTab[sheet][title] = []string{}
+				} else {
+					// Column has title and values
+					bookTab[sheet][title] = col[1:]
+				}
+			}
+		case Matrix:
+			// Table format across all sheets
+			bookMat[sheet] = append(bookMat[sheet], mat...)
+		default:
+			// Stats mode profiles each column
+			prof := &sheetStats{Columns: []*colStats{}, ColCount: len(mat)}
+			bookStats[sheet] = prof
+			for ci, col := range mat {
+				name, data := splitTitle(ci, col, !*noColNames)
+				st := columnStats(data)
+				if textColumn(name) {
+					st.Types = map[string]int{"string": st.Count}
+					st.Type, st.Mismatch = "string", 0
+				}
+				st.Name, st.Index = name, ci
+				prof.Columns = append(prof.Columns, st)
+				if st.Rows > prof.RowCount {
+					prof.RowCount = st.Rows
+				}
+				if !*asJson {
+					fmt.Fprintln(out, "Column stats:", `"`+name+`"`, st)
+				}
+			}
+		}
+	}
+	joinMats := make(map[string][][]string) // Sheets awaiting -join-sheets
+	var flatRows [][]string                 // Rows of the sheets stacked by -flatten
+	budget := *rowLimit                     // Data rows -limit still allows
+
+	if *stream {
+		if len(books) > 1 {
+			fatal("-stream reads a single input")
+		}
+		if *bom && !*asNDJSON {
+			out.WriteString("\xEF\xBB\xBF")
+		}
+		w := csv.NewWriter(encodeText(out, textEnc))
+		w.Comma = comma
+		if *asTSV {
+			w.Comma = '\t'
+		}
+
+		nStreamed := 0
+		for _, sheet := range selected {
+			if *useSheet != "" && sheet != *useSheet {
+				continue
+			}
+			if *rowLimit > 0 && budget == 0 {
+				break
+			}
+			if nStreamed > 0 && !*asNDJSON {
+				// Sheets are separated by a blank line
+				w.Flush()
+				fmt.Fprintln(out)
+			}
+			nStreamed++
+
+			var names []string
+			n, err := streamRows(xf, sheet, wantCols, preds, grepRe, grepVRe, budget, func(row []string, title bool) error {
+				switch {
+				case !*asNDJSON && title && *noColNames:
+					// Matches the buffered CSV output
+					return w.Write(make([]string, len(row)))
+				case !*asNDJSON:
+					return w.Write(row)
+				case title:
+					// Duplicate titles are renamed as in Map mode
+					seen := make(map[string][]string)
+					names = make([]string, len(row))
+					for i, name := range row {
+						if _, ok := seen[name]; ok {
+							name = uniqueTitle(seen, name)
+						}
+						seen[name] = nil
+						names[i] = name
+					}
+					return nil
+				}
+				keys, vals := orderKeys(names, row)
+				if manySheets {
+					keys = append([]string{"_sheet"}, keys...)
+					vals = append([]string{sheet}, vals...)
+				}
+				if err := writeObject(out, keys, vals, nil); err != nil {
+					return err
+				}
+				_, err := fmt.Fprintln(out)
+				return err
+			})
+			efatal(err, "could not stream sheet", sheet)
+			budget -= n
+			w.Flush()
+			efatal(w.Error(), "could not write output CSV")
+			notice("info: sheet:", `"`+sheet+`"`, "#rows streamed:", n)
+
+			if !manySheets {
+				break
+			}
+		}
+		if nStreamed < 1 {
+			fatalCode(exitNoSheet, "could not find sheet by name of:", *useSheet)
+		}
+		return
+	}
+
+	if *countOnly {
+		counts := make(map[string]sheetInfo)
+		nCounted := 0
+		for _, sheet := range selected {
+			if *useSheet != "" && sheet != *useSheet {
+				continue
+			}
+			nCounted++
+			info, err := sheetSize(xf, sheet)
+			efatal(err, "could not get rows for sheet", sheet)
+			if !*noColNames && info.Rows > 0 {
+				// Title row isn't data
+				info.Rows--
+			}
+
+			if *asJson {
+				counts[sheet] = sheetInfo{Rows: info.Rows, Cols: info.Cols}
+			} else if manySheets {
+				fmt.Fprintf(out, "%s\t%d\t%d\n", sheet, info.Rows, info.Cols)
+			} else {
+				fmt.Fprintln(out, info.Rows, info.Cols)
+			}
+			if !manySheets {
+				break
+			}
+		}
+		if nCounted < 1 {
+			fatalCode(exitNoSheet, "could not find sheet by name of:", *useSheet)
+		}
+		if *asJson {
+			efatal(jsonEncoder(out, *indent).Encode(counts), "could not JSON encode")
+		}
+		return
+	}
+
+	// Sheets to read, in order
+	var todo []string
+	for _, sheet := range selected {
+		if *useSheet != "" && sheet != *useSheet {
+			continue
+		}
+		todo = append(todo, sheet)
+		if !manySheets && joinNames == nil {
+			break
+		}
+	}
+	sheetFound := len(todo) > 0
+
+	// excelize loads comments and styles into the file as they're first asked for, which isn't safe across
+	// goroutines, so they're looked up once per input before the sheets are read
+	inputComments := make([]map[string][]xl.Comment, len(books))
+	inputStyles := make([][]cellStyle, len(books))
+	for bi, xf := range books {
+		if *withComments {
+			inputComments[bi] = xf.GetComments()
+		}
+		if *withStyles {
+			inputStyles[bi] = styleTable(xf)
+		}
+	}
+
+	// JSON output writes hyperlinked cells as {text, link} objects rather than "text (link)"
+	linkObjects := mode != Stats && (*asJson || *asRecords || *asNDJSON || *asFlat || *asSparse)
+
+	// Sheets are read independently, by up to -jobs at once, then added to the book in order
+	reads := make([]sheetRead, len(todo))
+	readSheet := func(i int) {
+		sheet := todo[i]
+		read := &reads[i]
+		out := &read.notes
+		started := time.Now()
+		var err error
+		if *withComments {
+			read.comments = make(map[string]string)
+		}
+		if *hyperlinks {
+			read.links = make(map[string]hyperlink)
+			read.targets = make(map[cellPos]string)
+		}
+		if *withStyles {
+			read.styles = make(map[string]cellStyle)
+		}
+		if *asSparse {
+			read.sparse = make(map[string]string)
+		}
+
+		// Cut a column to the rows read, with its title first
+		shape := func(col []string, title string) []string {
+			if area != nil {
+				col = area.rows(col)
+			}
+			if *alphaKeys {
+				col = append([]string{title}, col...)
+			}
+			if *mergeHeaders > 1 {
+				// The title rows become the one merged title
+				rest := []string{}
+				if len(col) > *mergeHeaders {
+					rest = col[*mergeHeaders:]
+				}
+				col = append([]string{title}, rest...)
+			}
+			if *rowRange != "" {
+				col = sliceRows(col, rowStart, rowEnd, !*noColNames)
+			}
+			return col
+		}
+
+		var mat [][]string // Column-major cells of this sheet, across inputs
+		colNum := 0        // 1-based column number within this sheet, for cell addresses
+		sheetElems := 0
+		for bi, xf := range books {
+			cols, err := xf.Cols(sheet)
+			if bi > 0 {
+				efatalCode(exitNoSheet, err, "could not get columns for sheet", sheet, "of input", inputs[bi])
+			}
+			efatal(err, "could not get columns for sheet", sheet)
+
+			if *withComments {
+				for _, c := range inputComments[bi][sheet] {
+					read.comments[c.Ref] = c.Text
+				}
+			}
+
+			var merged map[int]map[int]string // Column→row→anchor value of cells covered by merges
+			if *unmerge {
+				merged, err = mergeFills(xf, sheet, *rawValues)
+				efatal(err, "could not get merged cells for sheet", sheet)
+			}
+
+			var part [][]string // Column-major cells of this sheet in this input
+			colNum = 0
+			sheetRows := 0     // Rows of the longest column, before cutting
+			var upper []string // Last non-empty cell of each upper title row, for -merge-headers
+			if *mergeHeaders > 1 {
+				upper = make([]string, *mergeHeaders-1)
+			}
+			for cols.Next() {
+				read.nCols++
+				colNum++
+				col, err := cols.Rows(xl.Options{RawCellValue: *rawValues})
+				// Might be erroneous for titled/nontitled mode
+				read.rowSize = len(col)
+				efatal(err, "could not get rows of col for sheet", sheet)
+				if len(col) > sheetRows {
+					sheetRows = len(col)
+				}
+
+				if *trim {
+					for i := range col {
+						col[i] = strings.TrimSpace(col[i])
+					}
+				}
+				if *maxCellLen > 0 {
+					for i := range col {
+						col[i] = truncateCell(col[i], *maxCellLen, *truncMarker)
+					}
+				}
+
+				titleRow := 0
+				if area != nil {
+					if colNum < area.c1 || colNum > area.c2 {
+						continue
+					}
+					titleRow = area.r1 - 1
+				}
+
+				title, titled := "", len(col) > titleRow
+				if titled {
+					title = col[titleRow]
+				}
+				if *alphaKeys {
+					// Every row is data; the column letter is the title
+					title, _ = xl.ColumnNumberToName(colNum)
+					titled = true
+				}
+				if *mergeHeaders > 1 {
+					title, titled = mergedTitle(col, titleRow, upper, *headerSep), true
+				}
+
+				// Other columns are read for the row filters, then dropped by pickColumns
+				picked := wantCols == nil || (titled && contains(wantCols, title))
+
+				// Text columns are kept exactly as read
+				text := titled && textColumn(title)
+
+				if *evalFormulas && !text {
+					evalColumn(xf, sheet, colNum, col)
+				}
+				if picked {
+					read.errors = append(read.errors, errorCells(colNum, col)...)
+				}
+				if *unmerge {
+					col = fillMerged(col, merged[colNum])
+				}
+				// Comments go inside the link rendering added after the row filters
+				if *withComments && !*asJson {
+					commentColumn(colNum, col, read.comments)
+				}
+				var links map[int]string // Link targets by row index, before the column is cut
+				if *hyperlinks {
+					links = linkColumn(xf, sheet, colNum, len(col))
+				}
+				if *withStyles && picked {
+					styleColumn(xf, sheet, colNum, col, inputStyles[bi], read.styles)
+				}
+				if (*dates || *dateTimes || *dateLayout != "") && !text {
+					convertDates(xf, sheet, colNum, col, layout)
+				}
+				if *asSparse && picked {
+					sparseColumn(colNum, col, area, read.sparse)
+					sparseLinks(sheet, colNum, links, read.sparse, read.links)
+				}
+				col = shape(col, title)
+				if (*dropEmptyCols || *dropTitledEmpty) && blankColumn(col, !*noColNames, *dropTitledEmpty) {
+					continue
+				}
+				if len(links) > 0 {
+					// Cells are found again by their row ID and column, as rows move and columns are renamed
+					key := title
+					if *noColNames {
+						key = strconv.Itoa(len(part))
+					}
+					for ri, target := range links {
+						read.targets[cellPos{rowID(bi, ri+1), key}] = target
+					}
+				}
+
+				part = append(part, col)
+
+				for rowi, rowCell := range col {
+					if !*noColNames && rowi == 0 && len(strings.TrimSpace(rowCell)) > 0 {
+						if mode == Stats && !*asJson && bi == 0 {
+							fmt.Fprintln(out, "Column name:", `"`+rowCell+`"`, "at col#", colNum-1, "with", len(col), "rows")
+						}
+					}
+					sheetElems++
+				}
+			}
+			if *withIndex && len(part) > 0 {
+				part = append([][]string{indexColumn(part, shape(rowNumbers(sheetRows), indexTitle), indexTitle, !*noColNames)}, part...)
+			}
+			if *sourceCol != "" {
+				part = append(part, sourceColumn(part, inputs[bi], *sourceCol, !*noColNames))
+			}
+			if *hyperlinks && len(part) > 0 {
+				part = append(part, indexColumn(part, shape(rowIDs(bi, sheetRows), rowIDTitle), rowIDTitle, !*noColNames))
+			}
+			mat, err = unionRows(mat, part, !*noColNames)
+			efatal(err, "could not combine sheet", sheet, "of input", inputs[bi])
+		}
+
+		data := mat // Columns read from the sheet, without the -with-index and row ID columns
+		if *withIndex && len(data) > 0 {
+			data = data[1:]
+		}
+		if *hyperlinks && len(data) > 0 {
+			data = data[:len(data)-1]
+		}
+
+		if expectCols != nil {
+			var titles []string
+			for _, col := range data {
+				if len(col) > 0 {
+					titles = append(titles, col[0])
+				}
+			}
+			efatal(checkColumns(titles, expectCols, !*expectUnordered), "sheet", sheet, "doesn't have the -expect-cols columns")
+		}
+
+		if area != nil {
+			// The area may lie outside the cells the sheet uses
+			empty := true
+			for _, col := range data {
+				if !blankColumn(col, false, false) {
+					empty = false
+					break
+				}
+			}
+			if empty {
+				notice("warn: no cells of sheet", `"`+sheet+`"`, "are within the range read -> sheet is empty")
+				mat = nil
+			}
+		}
+
+		if *dropEmptyRows || len(fills) > 0 || len(preds) > 0 || grepRe != nil || grepVRe != nil || dedup || *sampleRows > 0 || sortCol != "" || *groupBy != "" || *pivot {
+			// Row filters work on the row-major view
+			rows := matRows(mat)
+			if *dropEmptyRows {
+				rows = dropBlankRows(rows, !*noColNames)
+			}
+			if len(fills) > 0 {
+				err = fillDown(rows, fills)
+				efatal(err, "could not apply -fill-down to sheet", sheet)
+			}
+			if len(preds) > 0 {
+				rows, err = filterRows(rows, preds)
+				efatal(err, "could not apply -where to sheet", sheet)
+			}
+			if grepRe != nil || grepVRe != nil {
+				rows = grepRows(rows, grepRe, grepVRe, !*noColNames)
+			}
+			if dedup {
+				var removed int
+				rows, removed, err = dedupRowsOn(rows, dedupCols, !*noColNames)
+				efatal(err, "could not apply -dedup to sheet", sheet)
+				notice("info: sheet:", `"`+sheet+`"`, "removed", removed, "duplicate rows")
+			}
+			if *sampleRows > 0 {
+				sample := newReservoir(*sampleRows, *seed)
+				first := 0
+				if !*noColNames && len(rows) > 0 {
+					first = 1
+				}
+				for _, row := range rows[first:] {
+					sample.offer(row)
+				}
+				rows = append(rows[:first:first], sample.rows()...)
+			}
+			if sortCol != "" {
+				err = sortRows(rows, sortCol, sortDesc)
+				efatal(err, "could not apply -sort to sheet", sheet)
+			}
+			if *hyperlinks && (*groupBy != "" || *pivot) {
+				// Aggregated rows have no IDs, so their cells are rendered before they're grouped
+				rows = matRows(renderLinks(matRows(rows), read.targets, sheet, !*noColNames, linkObjects, read.links))
+			}
+			if *groupBy != "" {
+				rows, err = groupRows(rows, *groupBy, aggregates, sheet)
+				efatal(err, "could not apply -group-by to sheet", sheet)
+			}
+			if *pivot {
+				rows, err = pivotRows(rows, *pivotRowCol, *pivotColCol, pivotAgg, sheet)
+				efatal(err, "could not apply -pivot to sheet", sheet)
+			}
+			mat = matRows(rows)
+		}
+
+		if *headRows > 0 || *tailRows > 0 {
+			mat = limitRows(mat, *headRows, *tailRows, !*noColNames)
+		}
+
+		if *hyperlinks && *groupBy == "" && !*pivot {
+			mat = renderLinks(mat, read.targets, sheet, !*noColNames, linkObjects, read.links)
+		}
+
+		if wantCols != nil {
+			// Reorder to match the request
+			var missing []string
+			want := wantCols
+			if *withIndex {
+				want = append([]string{indexTitle}, want...)
+			}
+			mat, missing = pickColumns(mat, want)
+			if len(missing) > 0 {
+				fatal("could not find columns by name of:", strings.Join(missing, ", "), "sheet:", sheet)
+			}
+		}
+
+		if renames != nil {
+			renamed := make(map[string]bool)
+			for _, col := range mat {
+				if len(col) > 0 {
+					if name, ok := renames[col[0]]; ok {
+						renamed[col[0]] = true
+						col[0] = name
+					}
+				}
+			}
+			for _, old := range renameOrder {
+				if !renamed[old] {
+					notice("warn: no column named", `"`+old+`"`, "to rename in sheet:", sheet)
+				}
+			}
+		}
+
+		if *transpose {
+			// Rows become columns
+			mat = matRows(mat)
+		}
+
+		if *snakeTitles && !*noColNames {
+			key := snakeCase
+			if *protoSafe {
+				key = protoName
+			}
+			read.titles = snakeColumns(mat, key)
+			if *keepOriginal && !*asJson {
+				for _, col := range mat {
+					if len(col) > 0 {
+						notice("info: sheet:", `"`+sheet+`"`, "title:", `"`+read.titles[col[0]]+`"`, "->", `"`+col[0]+`"`)
+					}
+				}
+			}
+		}
+
+		if *boolAs != "" {
+			for _, col := range mat {
+				if len(col) > 0 && !*noColNames && textColumn(col[0]) {
+					continue
+				}
+				if normalizeBools(col, !*noColNames, *boolAs) && len(col) > 0 {
+					read.bools = append(read.bools, col[0])
+				}
+			}
+		}
+
+		if *nullAs != "empty" && *nullAs != "null" && mode != Stats {
+			// Pad first so short columns get the sentinel too
+			rows := matRows(mat)
+			for ri, row := range rows {
+				if ri == 0 && !*noColNames {
+					continue
+				}
+				for ci, cell := range row {
+					if cell == "" {
+						row[ci] = *nullAs
+					}
+				}
+			}
+			mat = matRows(rows)
+		}
+
+		read.mat, read.cols, read.elems, read.took = mat, colNum, sheetElems, time.Since(started)
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < *jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				readSheet(i)
+			}
+		}()
+	}
+	for i := range todo {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	nSheets := 0
+	nRows := 0
+	nCols := 0
+	rowSize := 0
+
+	for i, sheet := range todo {
+		read := &reads[i]
+		bookTab[sheet] = make(map[string][]string)
+		bookMat[sheet] = [][]string{}
+		bookSheets = append(bookSheets, sheet)
+		nSheets++
+		nCols += read.nCols
+		nRows += read.elems
+		rowSize = read.rowSize
+		bookErrors[sheet] = read.errors
+		if *withComments {
+			bookComments[sheet] = read.comments
+		}
+		if *withStyles {
+			bookStyles[sheet] = read.styles
+		}
+		if *asSparse {
+			bookSparse[sheet] = read.sparse
+		}
+		for token, link := range read.links {
+			bookLinks[token] = link
+		}
+		if read.titles != nil {
+			bookTitles[sheet] = read.titles
+		}
+		if len(read.bools) > 0 {
+			bookBools[sheet] = make(map[string]bool)
+		}
+		for _, title := range read.bools {
+			bookBools[sheet][title] = true
+		}
+		out.Write(read.notes.Bytes())
+		mat := read.mat
+		if *printMapping && read.titles != nil {
+			for _, col := range mat {
+				if len(col) > 0 {
+					fmt.Fprintf(os.Stderr, "%s\t%s\t%s\n", sheet, read.titles[col[0]], col[0])
+				}
+			}
+		}
+
+		if joinNames != nil {
+			// Sheets are added once joined
+			joinMats[sheet] = mat
+		} else if *flatten {
+			// Sheets are added once stacked
+			if *sheetCol != "" && len(mat) > 0 {
+				mat = append(mat, sourceColumn(mat, sheet, *sheetCol, !*noColNames))
+			}
+			var differ bool
+			flatRows, differ = stackRows(flatRows, matRows(mat), !*noColNames)
+			if differ {
+				notice("warn: sheet:", `"`+sheet+`"`, "columns differ from the sheets before it -> missing cells left empty")
+			}
+		} else {
+			if *rowLimit > 0 {
+				var n int
+				mat, n = capRows(mat, budget, !*noColNames)
+				budget -= n
+			}
+			addSheet(sheet, mat)
+		}
+		if mode == Stats && !*asJson && len(bookErrors[sheet]) > 0 {
+			fmt.Fprintln(out, "Error cells:", len(bookErrors[sheet]), "at", strings.Join(bookErrors[sheet], ", "))
+		}
+
+		if *verbose {
+			notice("info: sheet:", `"`+sheet+`"`, "took", read.took.Round(time.Microsecond), "#cells:", read.elems)
+		}
+		if manySheets {
+			notice("info: sheet:", `"`+sheet+`"`, "#cols:", read.cols, "#elements:", read.elems, "#nrows:", read.rowSize)
+		}
+	}
+
+	// Drop the cells of sheets combined into one named name, moving what's recorded of them to it
+	mergeSheets := func(name string, sheets []string) {
+		bools := make(map[string]bool)
+		for _, sheet := range sheets {
+			for title := range bookBools[sheet] {
+				bools[title] = true
+			}
+			delete(bookBools, sheet)
+			delete(bookTab, sheet)
+			delete(bookMat, sheet)
+		}
+		bookBools[name] = bools
+	}
+
+	if joinNames != nil {
+		left, right := joinNames[0], joinNames[1]
+		rows, err := joinRows(matRows(joinMats[left]), matRows(joinMats[right]), left, right, *joinOn, *joinType == "left")
+		efatal(err, "could not join sheets", left, "and", right)
+
+		// The joined table replaces both sheets
+		name := left + "+" + right
+		mergeSheets(name, joinNames)
+		bookTab[name] = make(map[string][]string)
+		bookMat[name] = [][]string{}
+		bookSheets = []string{name}
+		mat := matRows(rows)
+		if *rowLimit > 0 {
+			mat, _ = capRows(mat, budget, true)
+		}
+		addSheet(name, mat)
+		notice("info: joined sheets", `"`+left+`"`, "and", `"`+right+`"`, "into", len(rows)-1, "rows")
+	}
+	if *flatten && len(bookSheets) > 0 {
+		// The stacked table replaces all the sheets, and is output alone
+		name := strings.Join(bookSheets, "+")
+		mergeSheets(name, bookSheets)
+		bookTab[name] = make(map[string][]string)
+		bookMat[name] = [][]string{}
+		notice("info: flattened", len(bookSheets), "sheets into", len(flatRows), "rows")
+		bookSheets = []string{name}
+		mat := matRows(flatRows)
+		if *rowLimit > 0 {
+			mat, _ = capRows(mat, budget, !*noColNames)
+		}
+		addSheet(name, mat)
+		manySheets = false
+	}
+
+	if !*noInfo {
+		notice("info: #sheets read:", nSheets, "#cols:", nCols, "#elements:", nRows, "#nrows:", rowSize)
+	}
+
+	if !sheetFound {
+		fatalCode(exitNoSheet, "could not find sheet by name of:", *useSheet)
+	}
+
+	if *failOnErrors {
+		var found []string
+		for _, sheet := range bookSheets {
+			for _, axis := range bookErrors[sheet] {
+				found = append(found, sheet+"!"+axis)
+			}
+		}
+		if len(found) > 0 {
+			fatal("err: found", len(found), "error cells ->", strings.Join(found, ", "))
+		}
+	}
+
+	if *dryRun {
+		// Report the plan rather than writing output
+		format := strings.TrimPrefix(outputExt(), ".")
+		if mode == Stats && !*asJson {
+			format = "stats"
+		}
+		dest := "stdout"
+		if *outPath != "" {
+			dest = *outPath
+		}
+		fmt.Fprintln(os.Stderr, "dry run: mode:", mode, "format:", format, "to:", dest)
+		var set []string
+		flag.Visit(func(f *flag.Flag) {
+			value := f.Value.String()
+			switch f.Name {
+			case "password":
+				value = "***"
+			case "header":
+				// Header values may be credentials, so only their names are shown
+				var redacted []string
+				for _, h := range headers {
+					name, _, _ := strings.Cut(h, ":")
+					redacted = append(redacted, name+": ***")
+				}
+				value = strings.Join(redacted, ", ")
+			}
+			set = append(set, "-"+f.Name+"="+value)
+		})
+		fmt.Fprintln(os.Stderr, "dry run: flags:", strings.Join(set, " "))
+		for _, sheet := range bookSheets {
+			cols, rows := sheetPlan(mode, bookMat[sheet], bookCols[sheet], bookTab[sheet], bookStats[sheet])
+			fmt.Fprintln(os.Stderr, "dry run: sheet:", `"`+sheet+`"`, "#rows:", rows, "#cols:", len(cols), "columns:", strings.Join(cols, ", "))
+		}
+		return
+	}
+
+	if *checksum {
+		sums := make(map[string]string)
+		for _, sheet := range bookSheets {
+			sums[sheet] = sheetChecksum(matRows(bookMat[sheet]))
+			if !*asJson {
+				fmt.Fprintf(out, "%s: %s\n", sheet, sums[sheet])
+			}
+		}
+		if *asJson {
+			efatal(jsonEncoder(out, *indent).Encode(sums), "could not JSON encode")
+		}
+		return
+	}
+
+	if *countDistinct != "" {
+		counts := make(map[string]distinctInfo)
+		for _, sheet := range bookSheets {
+			var col []string
+			for _, c := range bookMat[sheet] {
+				if len(c) > 0 && c[0] == *countDistinct {
+					col = c[1:]
+					break
+				}
+			}
+			if col == nil {
+				fatal("could not find column by name of:", *countDistinct, "sheet:", sheet)
+			}
+			values := distinctValues(col, *ignoreEmpty)
+			info := distinctInfo{Count: len(values)}
+			if *listDistinct {
+				info.Values = values
+			}
+
+			if *asJson {
+				counts[sheet] = info
+				continue
+			}
+			prefix := ""
+			if manySheets {
+				prefix = sheet + "\t"
+			}
+			fmt.Fprintln(out, prefix+strconv.Itoa(info.Count))
+			for _, v := range info.Values {
+				fmt.Fprintln(out, prefix+v)
+			}
+		}
+		if *asJson {
+			efatal(jsonEncoder(out, *indent).Encode(counts), "could not JSON encode")
+		}
+		return
+	}
+
+	castFailed := make(map[string]int) // Cells of each -cast column that didn't parse
+	defer func() {
+		for _, col := range castCols {
+			if n := castFailed[col]; n > 0 {
+				notice("warn:", n, "cells of column", `"`+col+`"`, "aren't of type", castTypes[col], "-> written as null")
+			}
+		}
+	}()
+
+	var jsonCell func(sheet, key, cell string) any // Chooses the JSON form of cells when they aren't all plain strings
+	if *hyperlinks || *boolAs == "json" || *nullAs == "null" || len(castCols) > 0 {
+		jsonCell = func(sheet, key, cell string) any {
+			if typ, ok := castTypes[key]; ok {
+				v, ok := castCell(cell, typ)
+				if !ok {
+					castFailed[key]++
+				}
+				return v
+			}
+			if cell == "" && *nullAs == "null" {
+				return nil
+			}
+			if link, ok := bookLinks[cell]; ok {
+				return link
+			}
+			if bookBools[sheet][key] && (cell == "true" || cell == "false") {
+				return cell == "true"
+			}
+			return cell
+		}
+	}
+	// jsonCell for the cells of one sheet, or nil if cells are written as strings
+	sheetCell := func(sheet string) func(key, cell string) any {
+		if jsonCell == nil {
+			return nil
+		}
+		return func(key, cell string) any { return jsonCell(sheet, key, cell) }
+	}
+
+	// Write the book in the chosen format
+	writeBook := func(out *bufio.Writer) {
+		// Sparse mode
+		if *asSparse {
+			efatal(encodeCells(jsonEncoder(out, *indent), bookSparse, jsonCell), "could not JSON encode")
+			return
+		}
+
+		// JSON mode
+		if *asJson {
+			enc := jsonEncoder(out, *indent)
+			switch mode {
+			case Matrix, Map:
+				book := make(map[string]any)
+				if mode == Matrix {
+					for sheet, mat := range bookMat {
+						book[sheet] = mat
+						if jsonCell != nil {
+							book[sheet] = matrixCells(mat, sheet, !*noColNames, jsonCell)
+						}
+					}
+				} else {
+					for sheet, tab := range bookTab {
+						book[sheet] = tab
+						if jsonCell != nil {
+							book[sheet] = convertCells(reflect.ValueOf(tab), sheet, sheet, jsonCell)
+						}
+					}
+				}
+				// Comments and original titles sit alongside the sheets rather than in cells
+				if *withComments {
+					book["_comments"] = bookComments
+				}
+				if *withStyles {
+					book["_styles"] = bookStyles
+				}
+				if *keepOriginal {
+					book["_titles"] = bookTitles
+				}
+				efatal(enc.Encode(book), "could not JSON encode")
+			case Stats:
+				var book any = bookStats
+				errs := make(map[string][]string)
+				for sheet, cells := range bookErrors {
+					if len(cells) > 0 {
+						errs[sheet] = cells
+					}
+				}
+				if len(errs) > 0 {
+					// Error cells sit alongside the sheets' column stats
+					withErrs := map[string]any{"_errors": errs}
+					for sheet, stats := range bookStats {
+						withErrs[sheet] = stats
+					}
+					book = withErrs
+				}
+				efatal(enc.Encode(book), "could not JSON encode")
+			}
+
+			return
+		}
+
+		// JSON Schema mode
+		if *asJSONSchema {
+			if mode != Map {
+				fatal("JSON Schema output requires Map mode")
+			}
+
+			schema := map[string]any{"$schema": "http://json-schema.org/draft-07/schema#"}
+			if manySheets {
+				props := make(map[string]any)
+				for _, sheet := range bookSheets {
+					props[sheet] = recordsSchema(bookCols[sheet], bookTab[sheet])
+				}
+				schema["type"] = "object"
+				schema["properties"] = props
+				schema["required"] = bookSheets
+			} else {
+				sheet := bookSheets[0]
+				schema["title"] = sheet
+				for k, v := range recordsSchema(bookCols[sheet], bookTab[sheet]) {
+					schema[k] = v
+				}
+			}
+			efatal(jsonEncoder(out, *indent).Encode(schema), "could not JSON encode")
+
+			return
+		}
+
+		// Template mode
+		if tmpl != nil {
+			if mode != Map {
+				fatal("template output requires Map mode")
+			}
+
+			data := struct {
+				Sheets  map[string][]map[string]string
+				Columns map[string][]string
+			}{make(map[string][]map[string]string), bookCols}
+			for _, sheet := range bookSheets {
+				data.Sheets[sheet] = tabRecords(bookCols[sheet], bookTab[sheet])
+			}
+			efatal(tmpl.Execute(out, data), "could not execute template")
+
+			return
+		}
+
+		// JSON records mode
+		if *asRecords {
+			if mode != Map {
+				fatal("records output requires Map mode")
+			}
+
+			enc := jsonEncoder(out, *indent)
+			if manySheets {
+				book := make(map[string][]orderedRecord)
+				for _, sheet := range bookSheets {
+					book[sheet] = orderedRecords(bookCols[sheet], bookTab[sheet], sheetCell(sheet))
+				}
+				efatal(enc.Encode(book), "could not JSON encode")
+			} else {
+				sheet := bookSheets[0]
+				efatal(enc.Encode(orderedRecords(bookCols[sheet], bookTab[sheet], sheetCell(sheet))), "could not JSON encode")
+			}
+
+			return
+		}
+
+		// Flat mode
+		if *asFlat {
+			if mode != Map {
+				fatal("flat output requires Map mode")
+			}
+
+			for _, sheet := range bookSheets {
+				names := bookCols[sheet]
+				prefix := *flatPrefix
+				if manySheets {
+					prefix += sheet + "."
+				}
+				// Cells are converted by their column's own name
+				orig := make(map[string]string, len(names))
+				keys := make([]string, len(names))
+				for i, name := range names {
+					keys[i] = prefix + name
+					orig[keys[i]] = name
+				}
+				var conv func(key, cell string) any
+				if jsonCell != nil {
+					conv = func(key, cell string) any { return jsonCell(sheet, orig[key], cell) }
+				}
+				for _, row := range tabRows(names, bookTab[sheet]) {
+					k, v := orderKeys(keys, row)
+					efatal(writeObject(out, k, v, conv), "could not JSON encode")
+					fmt.Fprintln(out)
+				}
+			}
+
+			return
+		}
+
+		// NDJSON mode
+		if *asNDJSON {
+			if mode != Map {
+				fatal("ndjson output requires Map mode")
+			}
+
+			for _, sheet := range bookSheets {
+				names := bookCols[sheet]
+				for _, row := range tabRows(names, bookTab[sheet]) {
+					keys, vals := orderKeys(names, row)
+					if manySheets {
+						keys = append([]string{"_sheet"}, keys...)
+						vals = append([]string{sheet}, vals...)
+					}
+					efatal(writeObject(out, keys, vals, sheetCell(sheet)), "could not JSON encode")
+					fmt.Fprintln(out)
+				}
+			}
+
+			return
+		}
+
+		// YAML mode
+		if *asYAML {
+			var doc *yaml.Node
+			switch mode {
+			case Matrix:
+				doc, err = yamlMat(bookSheets, bookMat)
+			case Map:
+				doc, err = yamlTab(bookSheets, bookCols, bookTab)
+			}
+			efatal(err, "could not build YAML document")
+
+			if doc != nil {
+				enc := yaml.NewEncoder(out)
+				efatal(enc.Encode(doc), "could not YAML encode")
+				efatal(enc.Close(), "could not YAML encode")
+			}
+
+			return
+		}
+
+		// XML mode
+		if *asXML {
+			book := xmlBook{}
+			for _, sheet := range bookSheets {
+				xs := xmlSheet{Name: sheet}
+				switch mode {
+				case Map:
+					names := bookCols[sheet]
+					for _, row := range tabRows(names, bookTab[sheet]) {
+						var xr xmlRow
+						for ci, cell := range row {
+							xr.Cells = append(xr.Cells, xmlCell{Name: names[ci], Value: cell})
+						}
+						xs.Rows = append(xs.Rows, xr)
+					}
+				case Matrix:
+					for _, row := range matRows(bookMat[sheet]) {
+						var xr xmlRow
+						for _, cell := range row {
+							xr.Cells = append(xr.Cells, xmlCell{Value: cell})
+						}
+						xs.Rows = append(xs.Rows, xr)
+					}
+				default:
+					fatal("XML output requires Map or Matrix mode")
+				}
+				book.Sheets = append(book.Sheets, xs)
+			}
+
+			fmt.Fprint(out, xml.Header)
+			enc := xml.NewEncoder(out)
+			if *indent > 0 {
+				enc.Indent("", strings.Repeat(" ", *indent))
+			}
+			efatal(enc.Encode(book), "could not XML encode")
+			fmt.Fprintln(out)
+
+			return
+		}
+
+		// TOML mode
+		if *asTOML {
+			if mode != Map {
+				fatal("TOML output requires Map mode")
+			}
+
+			// Cells stay strings so number-like values aren't converted lossily
+			enc := toml.NewEncoder(out)
+			if manySheets {
+				efatal(enc.Encode(bookTab), "could not TOML encode")
+			} else {
+				efatal(enc.Encode(bookTab[bookSheets[0]]), "could not TOML encode")
+			}
+
+			return
+		}
+
+		// SQL mode
+		if *asSQL {
+			if mode != Map {
+				fatal("SQL output requires Map mode")
+			}
+
+			for _, sheet := range bookSheets {
+				table := *sqlTable
+				if table == "" {
+					table = sheet
+				}
+				names := bookCols[sheet]
+				for _, row := range tabRows(names, bookTab[sheet]) {
+					fmt.Fprintln(out, sqlInsert(table, names, row, *sqlNullEmpty))
+				}
+			}
+
+			return
+		}
+
+		// Go syntax mode
+		if *asGo {
+			var book any
+			switch mode {
+			case Matrix:
+				book = bookMat
+			case Map:
+				book = bookTab
+			}
+			if book == nil {
+				return
+			}
+
+			var decl string
+			if *goVar != "" {
+				decl = "var " + *goVar + " = "
+			}
+			if *goFmt {
+				src, err := format.Source(append(goHeader(*goPackage, decl), goLiteral(book)...))
+				if err == nil {
+					out.Write(src)
+					if decl == "" {
+						fmt.Fprintln(out)
+					}
+					return
+				}
+				notice("warn: could not format Go output; writing it unformatted ->", err)
+			}
+			out.Write(goHeader(*goPackage, decl))
+			fmt.Fprintf(out, "%#v\n", book)
+
+			return
+		}
+
+		// Go struct mode
+		if *asGoStruct {
+			if mode != Map {
+				fatal("Go struct output requires Map mode")
+			}
+
+			out.Write(goHeader(*goPackage, ""))
+			declared := make(map[string]bool) // Type and slice names used so far
+			for i, sheet := range bookSheets {
+				if i > 0 {
+					fmt.Fprintln(out)
+				}
+				typeName := goIdent(sheet)
+				if typeName == "" {
+					typeName = "Sheet"
+				}
+				// Sheets whose names differ only in punctuation would declare the same type
+				for base, n := typeName, 2; declared[typeName] || declared[typeName+"Rows"]; n++ {
+					typeName = base + strconv.Itoa(n)
+				}
+				declared[typeName], declared[typeName+"Rows"] = true, true
+				src := goStruct(typeName, bookCols[sheet], bookTab[sheet])
+				formatted, err := format.Source(src)
+				if err != nil {
+					notice("warn: could not format Go source for sheet", sheet, "->", err)
+					formatted = src
+				}
+				out.Write(formatted)
+			}
+
+			return
+		}
+
+		// Pretty table mode
+		if *asPretty {
+			// Implicitly matrix mode
+			for i, sheet := range bookSheets {
+				if manySheets {
+					if i > 0 {
+						fmt.Fprintln(out)
+					}
+					fmt.Fprintln(out, sheet)
+				}
+				writePretty(out, matRows(bookMat[sheet]), !*noColNames, *maxWidth)
+			}
+
+			return
+		}
+
+		// Markdown mode
+		if *asMarkdown {
+			// Implicitly matrix mode
+			for i, sheet := range bookSheets {
+				if manySheets {
+					if i > 0 {
+						fmt.Fprintln(out)
+					}
+					fmt.Fprintf(out, "## %s\n\n", sheet)
+				}
+				writeMarkdown(out, matRows(bookMat[sheet]), !*noColNames)
+			}
+
+			return
+		}
+
+		// HTML mode
+		if *asHTML {
+			// Implicitly matrix mode
+			for _, sheet := range bookSheets {
+				if manySheets {
+					fmt.Fprintln(out, `<section class="xl-sheet">`)
+					fmt.Fprintf(out, "<h2>%s</h2>\n", html.EscapeString(sheet))
+				}
+				writeHTML(out, matRows(bookMat[sheet]), !*noColNames)
+				if manySheets {
+					fmt.Fprintln(out, "</section>")
+				}
+			}
+
+			return
+		}
+
+		// Excel mode
+		if *asXLSX {
+			// Implicitly matrix mode
+			nf := xl.NewFile()
+			if *appendTo != "" {
+				// Sheets are added to an existing workbook, which is saved in place
+				nf, err = xl.OpenFile(*appendTo)
+				if errors.Is(err, fs.ErrNotExist) {
+					efatalCode(exitNotFound, err, "could not open -append-to workbook")
+				}
+				efatal(err, "could not open -append-to workbook")
+			}
+			defer nf.Close()
+			for i, sheet := range bookSheets {
+				name := sheet
+				if *newSheetName != "" {
+					name = *newSheetName
+				}
+				switch {
+				case *appendTo == "" && i == 0:
+					nf.SetSheetName(nf.GetSheetName(0), name)
+				case *appendTo != "" && nf.GetSheetIndex(name) >= 0:
+					if !*overwriteSheet {
+						fatal("workbook", *appendTo, "already has a sheet named", `"`+name+`"`, "-> use -overwrite-sheet to replace it")
+					}
+					replaceSheet(nf, name)
+				default:
+					nf.NewSheet(name)
+				}
+				for ri, row := range matRows(bookMat[sheet]) {
+					axis, err := xl.CoordinatesToCellName(1, ri+1)
+					efatal(err, "could not build cell address for sheet", name)
+					efatal(nf.SetSheetRow(name, axis, &row), "could not write row to sheet", name)
+				}
+			}
+			if *appendTo != "" {
+				efatal(nf.Save(), "could not save -append-to workbook")
+				notice("info: sheets written to", *appendTo)
+			} else {
+				efatal(nf.Write(out), "could not write output excel")
+			}
+
+			return
+		}
+
+		// CSV mode
+		if *asCSV || *asTSV {
+			// Implicitly matrix mode
+			if *bom {
+				// Lets Excel detect UTF-8 when opening the file
+				out.WriteString("\xEF\xBB\xBF")
+			}
+			w := csv.NewWriter(encodeText(out, textEnc))
+			w.Comma = comma
+			if *asTSV {
+				// Fields containing tabs or newlines are still quoted by the writer
+				w.Comma = '\t'
+			}
+			for i, sheet := range bookSheets {
+				if i > 0 {
+					// Sheets are separated by a blank line
+					fmt.Fprintln(out)
+				}
+				tab := matRows(bookMat[sheet])
+				if *noColNames && len(tab) > 0 {
+					tab[0] = make([]string, len(tab[0]))
+				}
+				err := w.WriteAll(tab)
+				efatal(err, "could not write output CSV")
+			}
+
+			return
+		}
+	}
+
+	if !*split {
+		writeBook(out)
+		return
+	}
+
+	// Each sheet is written alone to its own file
+	if !strings.Contains(*outPath, "{sheet}") {
+		efatal(os.MkdirAll(*outPath, 0755), "could not create output directory")
+	}
+	allSheets, tabs, mats, cols, stats, comments, styles, sparse, titles, errs := bookSheets, bookTab, bookMat, bookCols, bookStats, bookComments, bookStyles, bookSparse, bookTitles, bookErrors
+	manySheets = false
+	for _, sheet := range allSheets {
+		bookSheets = []string{sheet}
+		bookTab = map[string]map[string][]string{sheet: tabs[sheet]}
+		bookMat = map[string][][]string{sheet: mats[sheet]}
+		bookCols = map[string][]string{sheet: cols[sheet]}
+		bookStats = map[string]*sheetStats{sheet: stats[sheet]}
+		bookComments = map[string]map[string]string{sheet: comments[sheet]}
+		bookStyles = map[string]map[string]cellStyle{sheet: styles[sheet]}
+		bookSparse = map[string]map[string]string{sheet: sparse[sheet]}
+		bookTitles = map[string]map[string]string{sheet: titles[sheet]}
+		bookErrors = map[string][]string{sheet: errs[sheet]}
+
+		path := splitPath(*outPath, sheet, outputExt())
+		if *gzipOut && !strings.HasSuffix(path, ".gz") {
+			path += ".gz"
+		}
+		f, err := os.Create(path)
+		efatal(err, "could not create output file for sheet", sheet)
+		var dst io.Writer = f
+		var gz *gzip.Writer
+		if strings.HasSuffix(path, ".gz") {
+			gz = gzip.NewWriter(f)
+			dst = gz
+		}
+		w := bufio.NewWriter(dst)
+		writeBook(w)
+		efatal(w.Flush(), "could not write output file for sheet", sheet)
+		if gz != nil {
+			efatal(gz.Close(), "could not write output file for sheet", sheet)
+		}
+		efatal(f.Close(), "could not write output file for sheet", sheet)
+		notice("info: sheet:", `"`+sheet+`"`, "written to", path)
+	}
+}
+
+// Column titles and data row count of a sheet as added to the book in the given mode, for -dry-run
+func sheetPlan(mode Mode, mat [][]string, names []string, tab map[string][]string, stats *sheetStats) ([]string, int) {
+	var cols []string
+	rows := 0
+	switch mode {
+	case Map:
+		cols = names
+		for _, col := range tab {
+			if len(col) > rows {
+				rows = len(col)
+			}
+		}
+	case Matrix:
+		for ci, col := range mat {
+			name, data := splitTitle(ci, col, !*noColNames)
+			cols = append(cols, name)
+			if len(data) > rows {
+				rows = len(data)
+			}
+		}
+	default:
+		if stats != nil {
+			for _, st := range stats.Columns {
+				cols = append(cols, st.Name)
+			}
+			rows = stats.RowCount
+		}
+	}
+	return cols, rows
+}
+
+// File name extension for the chosen output format
+func outputExt() string {
+	switch {
+	case *asNDJSON, *asFlat:
+		return ".ndjson"
+	case *asGo, *asGoStruct:
+		return ".go"
+	case *asYAML:
+		return ".yaml"
+	case *asTOML:
+		return ".toml"
+	case *asXML:
+		return ".xml"
+	case *asSQL:
+		return ".sql"
+	case *templatePath != "":
+		return ".txt"
+	case *asCSV:
+		return ".csv"
+	case *asTSV:
+		return ".tsv"
+	case *asPretty:
+		return ".txt"
+	case *asMarkdown:
+		return ".md"
+	case *asHTML:
+		return ".html"
+	case *asXLSX:
+		return ".xlsx"
+	}
+	return ".json"
+}
+
+// Path of a sheet's -split output: pattern with {sheet} replaced, or a file in the pattern directory
+func splitPath(pattern, sheet, ext string) string {
+	// Sheet names may hold characters that aren't safe in file names
+	name := strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, sheet)
+	if strings.Trim(name, ".") == "" {
+		name = strings.Repeat("_", len(name))
+	}
+
+	if strings.Contains(pattern, "{sheet}") {
+		return strings.ReplaceAll(pattern, "{sheet}", name)
+	}
+	return filepath.Join(pattern, name+ext)
+}
+
+// Transpose a column-major matrix into rows; short columns are padded with empty strings
+// Columns are read from sheet row 1 and only ever sliced by the same row bounds, so index ri is the same sheet row in all of them
+// and the padding only falls below a column's last cell
+func matRows(records [][]string) [][]string {
+	nCols := len(records)
+	var nRows int = 0
+	for ci := 0; ci < nCols; ci++ {
+		if len(records[ci]) > nRows {
+			nRows = len(records[ci])
+		}
+	}
+
+	tab := make([][]string, nRows)
+	for i := 0; i < len(tab); i++ {
+		tab[i] = make([]string, nCols)
+	}
+
+	for ci := 0; ci < len(records); ci++ {
+		for ri := 0; ri < len(records[ci]); ri++ {
+			tab[ri][ci] = records[ci][ri]
+		}
+	}
+	return tab
+}
+
+// Append the data rows of a column-major part to mat, matching columns by title when titled
+func unionRows(mat, part [][]string, titled bool) ([][]string, error) {
+	if mat == nil {
+		return part, nil
+	}
+	rows, more := matRows(mat), matRows(part)
+	if len(more) < 1 {
+		return mat, nil
+	}
+	if !titled {
+		return matRows(append(rows, more...)), nil
+	}
+
+	idx := make([]int, len(rows[0]))
+	for ci, title := range rows[0] {
+		idx[ci] = indexOf(more[0], title)
+		if idx[ci] < 0 {
+			return nil, fmt.Errorf("no column named %q", title)
+		}
+	}
+	if len(more[0]) != len(rows[0]) {
+		return nil, fmt.Errorf("has %d columns rather than %d", len(more[0]), len(rows[0]))
+	}
+	for _, row := range more[1:] {
+		aligned := make([]string, len(idx))
+		for ci, i := range idx {
+			aligned[ci] = row[i]
+		}
+		rows = append(rows, aligned)
+	}
+	return matRows(rows), nil
+}
+
+// Stack the rows of more under rows, matching columns by title when titled; reports whether their columns differ
+// Columns only in more are added to the end, and cells missing from either side are left empty
+func stackRows(rows, more [][]string, titled bool) ([][]string, bool) {
+	if len(more) < 1 {
+		return rows, false
+	}
+	if len(rows) < 1 {
+		return more, false
+	}
+	if !titled {
+		return append(rows, more...), len(more[0]) != len(rows[0])
+	}
+
+	title := rows[0]
+	differ := len(more[0]) != len(title)
+	idx := make([]int, len(more[0]))
+	for ci, name := range more[0] {
+		idx[ci] = indexOf(title, name)
+		if idx[ci] < 0 {
+			differ = true
+			title = append(title, name)
+			idx[ci] = len(title) - 1
+		}
+	}
+	rows[0] = title
+	for _, row := range more[1:] {
+		aligned := make([]string, len(title))
+		for ci, i := range idx {
+			aligned[i] = row[ci]
+		}
+		rows = append(rows, aligned)
+	}
+	return rows, differ
+}
+
+// Sheet row numbers 1 through n, as cells
+func rowNumbers(n int) []string {
+	col := make([]string, n)
+	for i := range col {
+		col[i] = strconv.Itoa(i + 1)
+	}
+	return col
+}
+
+// A column titled title of a column-major part from its cut row numbers or IDs, as long as the part's longest column
+func indexColumn(part [][]string, rows []string, title string, titled bool) []string {
+	n := 0
+	for _, col := range part {
+		if len(col) > n {
+			n = len(col)
+		}
+	}
+	if len(rows) > n {
+		rows = rows[:n]
+	}
+	if titled && len(rows) > 0 {
+		rows[0] = title
+	}
+	return rows
+}
+
+// IDs of the n rows of a sheet in input number input, for finding their hyperlinks after the row filters
+func rowIDs(input, n int) []string {
+	col := make([]string, n)
+	for i := range col {
+		col[i] = rowID(input, i+1)
+	}
+	return col
+}
+
+func rowID(input, row int) string {
+	return strconv.Itoa(input) + ":" + strconv.Itoa(row)
+}
+
+// Cells of a row-major row other than its -with-index and row ID cells
+func dataCells(row []string) []string {
+	if *hyperlinks && len(row) > 0 {
+		row = row[:len(row)-1]
+	}
+	if *withIndex && len(row) > 0 {
+		return row[1:]
+	}
+	return row
+}
+
+// Column naming the input of every row of a column-major part
+func sourceColumn(part [][]string, source, title string, titled bool) []string {
+	if source == "" {
+		source = "-"
+	}
+	n := 0
+	for _, col := range part {
+		if len(col) > n {
+			n = len(col)
+		}
+	}
+
+	col := make([]string, n)
+	for i := range col {
+		col[i] = source
+	}
+	if titled && n > 0 {
+		col[0] = title
+	}
+	return col
+}
+
+// Helpers available to -template, beyond the text/template builtins
+var templateFuncs = template.FuncMap{
+	"join":  func(list []string, sep string) string { return strings.Join(list, sep) },
+	"split": strings.Split,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+}
+
+// Transpose a column→values map back into rows ordered by names; short columns are padded with empty strings
+func tabRows(names []string, tab map[string][]string) [][]string {
+	nRows := 0
+	for _, name := range names {
+		if len(tab[name]) > nRows {
+			nRows = len(tab[name])
+		}
+	}
+
+	rows := make([][]string, nRows)
+	for ri := range rows {
+		rows[ri] = make([]string, len(names))
+		for ci, name := range names {
+			if ri < len(tab[name]) {
+				rows[ri][ci] = tab[name][ri]
+			}
+		}
+	}
+	return rows
+}
+
+// Suffix a title as title_2, title_3, ... until it's not already a key
+func uniqueTitle(tab map[string][]string, title string) string {
+	for n := 2; ; n++ {
+		name := title + "_" + strconv.Itoa(n)
+		if _, ok := tab[name]; !ok {
+			return name
+		}
+	}
+}
+
+// Lowercase title with runs of anything but letters and digits turned into single underscores
+func snakeCase(title string) string {
+	var b strings.Builder
+	gap := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if gap && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			gap = false
+		} else {
+			gap = true
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// Title as a Protocol Buffers field name: snake_case ASCII letters, digits, and underscores, not starting with a digit
+func protoName(title string) string {
+	key := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII {
+			return -1
+		}
+		return r
+	}, snakeCase(title))
+	key = strings.Trim(key, "_")
+	if key == "" || unicode.IsDigit(rune(key[0])) {
+		key = "_" + key
+	}
+	return key
+}
+
+// Rewrite the titles of a column-major matrix with key, snakeCase or protoName, suffixing keys that distinct titles collapse onto
+// Returns the original title of each key
+func snakeColumns(mat [][]string, key func(string) string) map[string]string {
+	orig := make(map[string]string)
+	for _, col := range mat {
+		if len(col) < 1 {
+			continue
+		}
+		k := key(col[0])
+		for n := 2; ; n++ {
+			if prev, ok := orig[k]; !ok || prev == col[0] {
+				break
+			}
+			k = key(col[0]) + "_" + strconv.Itoa(n)
+		}
+		orig[k] = col[0]
+		col[0] = k
+	}
+	return orig
+}
+
+// Compare titles to the expected columns, describing any missing, extra, or misordered ones
+func checkColumns(titles, expect []string, ordered bool) error {
+	var missing, extra []string
+	for _, name := range expect {
+		if !contains(titles, name) {
+			missing = append(missing, name)
+		}
+	}
+	for _, name := range titles {
+		if !contains(expect, name) {
+			extra = append(extra, name)
+		}
+	}
+
+	var diff []string
+	if len(missing) > 0 {
+		diff = append(diff, "missing: "+strings.Join(missing, ", "))
+	}
+	if len(extra) > 0 {
+		diff = append(diff, "extra: "+strings.Join(extra, ", "))
+	}
+	if len(diff) < 1 && ordered {
+		for i := range titles {
+			if i >= len(expect) || titles[i] != expect[i] {
+				diff = append(diff, "out of order: "+strings.Join(titles, ", "))
+				break
+			}
+		}
+	}
+	if len(diff) > 0 {
+		return errors.New(strings.Join(diff, "; "))
+	}
+	return nil
+}
+
+// Report whether s is in list
+func contains(list []string, s string) bool {
+	return indexOf(list, s) >= 0
+}
+
+// Position of s in list, or -1
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// Name of the first set flag of flags in sorted order, so conflicts are reported the same way every run, or "" if none is set
+func firstSet(flags map[string]bool) string {
+	var names []string
+	for name, set := range flags {
+		if set {
+			names = append(names, name)
+		}
+	}
+	if len(names) < 1 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// Reorder columns by title to match names, reporting any names not found
+func pickColumns(mat [][]string, names []string) (picked [][]string, missing []string) {
+	for _, name := range names {
+		found := false
+		for _, col := range mat {
+			if len(col) > 0 && col[0] == name {
+				picked = append(picked, col)
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, name)
+		}
+	}
+	return picked, missing
+}
+
+// Parse a START:END row range; END may be omitted, returning 0
+func parseRowRange(s string) (start, end int, err error) {
+	first, last, _ := strings.Cut(s, ":")
+	if start, err = strconv.Atoi(first); err != nil {
+		return 0, 0, fmt.Errorf("bad start row %q", first)
+	}
+	if start < 1 {
+		start = 1
+	}
+	if last == "" {
+		return start, 0, nil
+	}
+	if end, err = strconv.Atoi(last); err != nil {
+		return 0, 0, fmt.Errorf("bad end row %q", last)
+	}
+	if end < 1 {
+		// An END of 0 would read as unbounded
+		return 0, 0, fmt.Errorf("end row %d is before the first row", end)
+	}
+	return start, end, nil
+}
+
+// Rectangle of cells selected by -range, 1-based and inclusive
+type cellArea struct {
+	c1, r1, c2, r2 int
+}
+
+// Parse an A1:B2 style range; its corners may be given in any order
+func parseCellRange(s string) (cellArea, error) {
+	first, last, ok := strings.Cut(s, ":")
+	if !ok {
+		return cellArea{}, fmt.Errorf("malformed range %q; expected A1:B2", s)
+	}
+	var a cellArea
+	var err error
+	if a.c1, a.r1, err = xl.CellNameToCoordinates(first); err != nil {
+		return cellArea{}, err
+	}
+	if a.c2, a.r2, err = xl.CellNameToCoordinates(last); err != nil {
+		return cellArea{}, err
+	}
+	if a.c1 > a.c2 {
+		a.c1, a.c2 = a.c2, a.c1
+	}
+	if a.r1 > a.r2 {
+		a.r1, a.r2 = a.r2, a.r1
+	}
+	return a, nil
+}
+
+// Sheet and area a defined name refers to, preferring a workbook-wide name to one scoped to a sheet
+func definedRange(xf *xl.File, name string) (string, cellArea, error) {
+	var found *xl.DefinedName
+	var names []string
+	defined := xf.GetDefinedName()
+	for i, dn := range defined {
+		names = append(names, dn.Name)
+		if dn.Name == name && (found == nil || dn.Scope == "Workbook") {
+			found = &defined[i]
+		}
+	}
+	if found == nil {
+		if len(names) < 1 {
+			return "", cellArea{}, fmt.Errorf("no name %q; the workbook defines no names", name)
+		}
+		return "", cellArea{}, fmt.Errorf("no name %q; defined names are: %s", name, strings.Join(names, ", "))
+	}
+
+	// References look like Sheet1!$A$1:$C$9 or 'My Sheet'!$A$1
+	ref := strings.TrimPrefix(found.RefersTo, "=")
+	i := strings.LastIndex(ref, "!")
+	if i < 1 {
+		return "", cellArea{}, fmt.Errorf("name %q refers to %q, which isn't a range of cells", name, found.RefersTo)
+	}
+	sheet, cells := ref[:i], strings.ReplaceAll(ref[i+1:], "$", "")
+	if strings.HasPrefix(sheet, "'") && strings.HasSuffix(sheet, "'") {
+		sheet = strings.ReplaceAll(sheet[1:len(sheet)-1], "''", "'")
+	}
+	if !strings.Contains(cells, ":") {
+		cells += ":" + cells
+	}
+	a, err := parseCellRange(cells)
+	if err != nil {
+		return "", cellArea{}, fmt.Errorf("name %q refers to %q, which isn't a range of cells", name, found.RefersTo)
+	}
+	return sheet, a, nil
+}
+
+// Parse a C:F style range of column letters into column numbers; an open end is the last column
+func parseColRange(s string) (int, int, error) {
+	first, last, ok := strings.Cut(s, ":")
+	if !ok || first == "" {
+		return 0, 0, fmt.Errorf("malformed column range %q; expected C:F or C:", s)
+	}
+	lo, err := xl.ColumnNameToNumber(first)
+	if err != nil {
+		return 0, 0, err
+	}
+	hi := xl.TotalColumns
+	if last != "" {
+		if hi, err = xl.ColumnNameToNumber(last); err != nil {
+			return 0, 0, err
+		}
+	}
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	return lo, hi, nil
+}
+
+// Rows of a column within the area, clamped to the column; the first is padded in as the title if the column ends above the area
+func (a cellArea) rows(col []string) []string {
+	for len(col) < a.r1 {
+		col = append(col, "")
+	}
+	hi := len(col)
+	if a.r2 < hi {
+		hi = a.r2
+	}
+	if hi < a.r1-1 {
+		// Rows were skipped past the bottom of the area
+		return []string{}
+	}
+	return col[a.r1-1 : hi]
+}
+
+// Keep only the 1-based rows start through end of a column, clamped to its length; end 0 is unbounded
+func sliceRows(col []string, start, end int, keepTitle bool) []string {
+	lo, hi := start-1, len(col)
+	if end != 0 && end < hi {
+		hi = end
+	}
+	if keepTitle && lo == 0 {
+		lo = 1
+	}
+
+	kept := []string{}
+	if keepTitle && len(col) > 0 {
+		kept = append(kept, col[0])
+	}
+	if lo < hi {
+		kept = append(kept, col[lo:hi]...)
+	}
+	return kept
+}
+
+// Keep at most budget data rows of a column-major matrix, returning it and how many data rows it has left
+func capRows(mat [][]string, budget int, titled bool) ([][]string, int) {
+	first := 1 // 1-based position of the first data row
+	if titled {
+		first = 2
+	}
+	n := 0
+	for _, col := range mat {
+		if len(col)-first+1 > n {
+			n = len(col) - first + 1
+		}
+	}
+	if n <= budget {
+		return mat, n
+	}
+
+	for ci := range mat {
+		if budget == 0 && !titled {
+			mat[ci] = []string{}
+			continue
+		}
+		mat[ci] = sliceRows(mat[ci], first, first+budget-1, titled)
+	}
+	return mat, budget
+}
+
+// Remove rows whose cells are all empty or whitespace; a title row is always kept
+func dropBlankRows(rows [][]string, titled bool) [][]string {
+	var kept [][]string
+	for ri, row := range rows {
+		blank := true
+		for _, cell := range dataCells(row) {
+			if strings.TrimSpace(cell) != "" {
+				blank = false
+				break
+			}
+		}
+		if !blank || (titled && ri == 0) {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
+
+// Report whether a column's data cells are all empty or whitespace; titled columns only count when dropTitled is set
+func blankColumn(col []string, titled, dropTitled bool) bool {
+	data := col
+	if titled && len(col) > 0 {
+		if strings.TrimSpace(col[0]) != "" && !dropTitled {
+			return false
+		}
+		data = col[1:]
+	}
+	for _, cell := range data {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Row filter parsed from -where
+type predicate struct {
+	col   string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+// Parse a COL=VALUE, COL!=VALUE, or COL~REGEX expression
+func parsePredicate(s string) (predicate, error) {
+	i := strings.IndexAny(s, "=!~")
+	if i < 1 {
+		return predicate{}, fmt.Errorf("malformed expression %q; expected COL=VALUE, COL!=VALUE, or COL~REGEX", s)
+	}
+
+	p := predicate{col: s[:i], op: s[i : i+1], value: s[i+1:]}
+	switch p.op {
+	case "!":
+		if !strings.HasPrefix(p.value, "=") {
+			return predicate{}, fmt.Errorf("malformed expression %q; expected COL!=VALUE", s)
+		}
+		p.op, p.value = "!=", p.value[1:]
+	case "~":
+		re, err := regexp.Compile(p.value)
+		if err != nil {
+			return predicate{}, err
+		}
+		p.re = re
+	}
+	return p, nil
+}
+
+// Report whether a cell satisfies the predicate
+func (p predicate) match(cell string) bool {
+	switch p.op {
+	case "!=":
+		return cell != p.value
+	case "~":
+		return p.re.MatchString(cell)
+	}
+	return cell == p.value
+}
+
+// Keep the title row and rows matching every predicate
+func filterRows(rows [][]string, preds []predicate) ([][]string, error) {
+	if len(rows) < 1 {
+		return rows, nil
+	}
+
+	idx := make([]int, len(preds))
+	for pi, p := range preds {
+		idx[pi] = indexOf(rows[0], p.col)
+		if idx[pi] < 0 {
+			return nil, fmt.Errorf("no column named %q", p.col)
+		}
+	}
+
+	kept := [][]string{rows[0]}
+	for _, row := range rows[1:] {
+		ok := true
+		for pi, p := range preds {
+			if !p.match(row[idx[pi]]) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			kept = append(kept, row)
+		}
+	}
+	return kept, nil
+}
+
+// Whether any cell of row matches keep, if set, and none matches drop, if set
+func grepRow(row []string, keep, drop *regexp.Regexp) bool {
+	matches := func(re *regexp.Regexp) bool {
+		for _, cell := range row {
+			if re.MatchString(cell) {
+				return true
+			}
+		}
+		return false
+	}
+	return (keep == nil || matches(keep)) && (drop == nil || !matches(drop))
+}
+
+// Keep the rows passing grepRow; the title row, if any, always stays
+func grepRows(rows [][]string, keep, drop *regexp.Regexp, titled bool) [][]string {
+	var kept [][]string
+	for i, row := range rows {
+		if (titled && i == 0) || grepRow(dataCells(row), keep, drop) {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
+
+// Join two titled row-major tables on a key column; right rows are matched in order, and repeats multiply
+// Other titles present in both are prefixed with their sheet name
+// With left set, left rows without a match are kept with empty right cells
+func joinRows(lrows, rrows [][]string, lname, rname, key string, left bool) ([][]string, error) {
+	if len(lrows) < 1 || len(rrows) < 1 {
+		return nil, fmt.Errorf("both sheets need a title row")
+	}
+	lk, rk := indexOf(lrows[0], key), indexOf(rrows[0], key)
+	if lk < 0 {
+		return nil, fmt.Errorf("no column named %q in sheet %q", key, lname)
+	}
+	if rk < 0 {
+		return nil, fmt.Errorf("no column named %q in sheet %q", key, rname)
+	}
+
+	var title []string
+	for ci, t := range lrows[0] {
+		if ci != lk && contains(rrows[0], t) {
+			t = lname + "." + t
+		}
+		title = append(title, t)
+	}
+	for ci, t := range rrows[0] {
+		if ci == rk {
+			continue
+		}
+		if contains(lrows[0], t) {
+			t = rname + "." + t
+		}
+		title = append(title, t)
+	}
+
+	matches := make(map[string][][]string)
+	for _, row := range rrows[1:] {
+		matches[row[rk]] = append(matches[row[rk]], row)
+	}
+
+	joined := [][]string{title}
+	for _, lrow := range lrows[1:] {
+		rmatch := matches[lrow[lk]]
+		if len(rmatch) < 1 && left {
+			rmatch = [][]string{make([]string, len(rrows[0]))}
+		}
+		for _, rrow := range rmatch {
+			row := append([]string{}, lrow...)
+			row = append(row, rrow[:rk]...)
+			row = append(row, rrow[rk+1:]...)
+			joined = append(joined, row)
+		}
+	}
+	return joined, nil
+}
+
+// Column summary parsed from -agg
+type aggregate struct {
+	col string
+	fn  string
+}
+
+// Parse a COL:FUNC expression
+func parseAggregate(s string) (aggregate, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 1 {
+		return aggregate{}, fmt.Errorf("malformed expression %q; expected COL:FUNC", s)
+	}
+
+	a := aggregate{col: s[:i], fn: s[i+1:]}
+	switch a.fn {
+	case "sum", "avg", "min", "max", "count":
+	default:
+		return aggregate{}, fmt.Errorf("unknown function %q in %q; expected sum, avg, min, max, or count", a.fn, s)
+	}
+	return a, nil
+}
+
+// Collapse data rows into one row per distinct value of the group column, in order of first appearance
+// The result is titled by the group column and COL_FUNC per aggregate; with no aggregates it counts rows
+func groupRows(rows [][]string, group string, aggs []aggregate, sheet string) ([][]string, error) {
+	if len(rows) < 1 {
+		return rows, nil
+	}
+	gi := indexOf(rows[0], group)
+	if gi < 0 {
+		return nil, fmt.Errorf("no column named %q", group)
+	}
+
+	title := []string{group}
+	idx := make([]int, len(aggs))
+	for ai, a := range aggs {
+		idx[ai] = indexOf(rows[0], a.col)
+		if idx[ai] < 0 {
+			return nil, fmt.Errorf("no column named %q", a.col)
+		}
+		title = append(title, a.col+"_"+a.fn)
+	}
+	if len(aggs) < 1 {
+		title = append(title, "count")
+	}
+
+	var keys []string
+	members := make(map[string][][]string)
+	for _, row := range rows[1:] {
+		key := row[gi]
+		if _, ok := members[key]; !ok {
+			keys = append(keys, key)
+		}
+		members[key] = append(members[key], row)
+	}
+
+	skipped := make([]int, len(aggs))
+	grouped := [][]string{title}
+	for _, key := range keys {
+		out := []string{key}
+		if len(aggs) < 1 {
+			out = append(out, strconv.Itoa(len(members[key])))
+		}
+		for ai, a := range aggs {
+			var vals []float64
+			count := 0
+			for _, row := range members[key] {
+				cell := row[idx[ai]]
+				if cell == "" {
+					continue
+				}
+				count++
+				f, ok := parseNumber(cell)
+				if !ok {
+					skipped[ai]++
+					continue
+				}
+				vals = append(vals, f)
+			}
+			out = append(out, aggregateValue(a.fn, vals, count))
+		}
+		grouped = append(grouped, out)
+	}
+
+	for ai, n := range skipped {
+		if n > 0 && aggs[ai].fn != "count" {
+			notice("warn: skipped", n, "non-numeric cells of column", `"`+aggs[ai].col+`"`, "sheet:", sheet, "-> not aggregated")
+		}
+	}
+	return grouped, nil
+}
+
+// Cross-tabulate data rows by the distinct values of two columns, in order of first appearance, summarizing agg in each cell
+// The result is titled by the row column and each value of the column column
+func pivotRows(rows [][]string, rowCol, colCol string, agg aggregate, sheet string) ([][]string, error) {
+	if len(rows) < 1 {
+		return rows, nil
+	}
+	ri, ci, vi := indexOf(rows[0], rowCol), indexOf(rows[0], colCol), indexOf(rows[0], agg.col)
+	for _, c := range []struct {
+		name string
+		i    int
+	}{{rowCol, ri}, {colCol, ci}, {agg.col, vi}} {
+		if c.i < 0 {
+			return nil, fmt.Errorf("no column named %q", c.name)
+		}
+	}
+
+	var rowKeys, colKeys []string
+	cells := make(map[[2]string][]string) // Values by row and column key
+	seenRow, seenCol := make(map[string]bool), make(map[string]bool)
+	for _, row := range rows[1:] {
+		rk, ck := row[ri], row[ci]
+		if !seenRow[rk] {
+			seenRow[rk] = true
+			rowKeys = append(rowKeys, rk)
+		}
+		if !seenCol[ck] {
+			seenCol[ck] = true
+			colKeys = append(colKeys, ck)
+		}
+		cells[[2]string{rk, ck}] = append(cells[[2]string{rk, ck}], row[vi])
+	}
+
+	skipped := 0
+	pivoted := [][]string{append([]string{rowCol}, colKeys...)}
+	for _, rk := range rowKeys {
+		out := []string{rk}
+		for _, ck := range colKeys {
+			var vals []float64
+			count := 0
+			for _, cell := range cells[[2]string{rk, ck}] {
+				if cell == "" {
+					continue
+				}
+				count++
+				f, ok := parseNumber(cell)
+				if !ok {
+					skipped++
+					continue
+				}
+				vals = append(vals, f)
+			}
+			out = append(out, aggregateValue(agg.fn, vals, count))
+		}
+		pivoted = append(pivoted, out)
+	}
+
+	if skipped > 0 && agg.fn != "count" {
+		notice("warn: skipped", skipped, "non-numeric cells of column", `"`+agg.col+`"`, "sheet:", sheet, "-> not aggregated")
+	}
+	return pivoted, nil
+}
+
+// Apply an aggregate function; count is of non-empty cells, the rest are of numbers and empty if there are none
+func aggregateValue(fn string, vals []float64, count int) string {
+	if fn == "count" {
+		return strconv.Itoa(count)
+	}
+	if len(vals) < 1 {
+		return ""
+	}
+
+	result := vals[0]
+	switch fn {
+	case "sum", "avg":
+		result = 0
+		for _, v := range vals {
+			result += v
+		}
+		if fn == "avg" {
+			result /= float64(len(vals))
+		}
+	case "min":
+		for _, v := range vals {
+			result = math.Min(result, v)
+		}
+	case "max":
+		for _, v := range vals {
+			result = math.Max(result, v)
+		}
+	}
+	return strconv.FormatFloat(result, 'f', -1, 64)
+}
+
+// Replace empty data cells of the named columns with the nearest non-empty value above
+func fillDown(rows [][]string, cols []string) error {
+	if len(rows) < 1 {
+		return nil
+	}
+	for _, col := range cols {
+		ci := indexOf(rows[0], col)
+		if ci < 0 {
+			return fmt.Errorf("no column named %q", col)
+		}
+		last := ""
+		for _, row := range rows[1:] {
+			if row[ci] == "" {
+				row[ci] = last
+			} else {
+				last = row[ci]
+			}
+		}
+	}
+	return nil
+}
+
+// Remove data rows repeating an earlier row, comparing only the named columns if any
+// Returns the kept rows and how many were removed
+func dedupRowsOn(rows [][]string, cols []string, titled bool) ([][]string, int, error) {
+	if len(rows) < 1 {
+		return rows, 0, nil
+	}
+
+	var idx []int
+	for _, col := range cols {
+		ci := indexOf(rows[0], col)
+		if ci < 0 {
+			return nil, 0, fmt.Errorf("no column named %q", col)
+		}
+		idx = append(idx, ci)
+	}
+
+	var kept [][]string
+	data := rows
+	if titled {
+		kept, data = rows[:1], rows[1:]
+	}
+	seen := make(map[string]bool)
+	for _, row := range data {
+		key := dataCells(row)
+		if idx != nil {
+			key = make([]string, len(idx))
+			for i, ci := range idx {
+				key[i] = row[ci]
+			}
+		}
+		// NUL can't be typed into a cell, so it keeps keys unambiguous
+		k := strings.Join(key, "\x00")
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		kept = append(kept, row)
+	}
+	return kept, len(rows) - len(kept), nil
+}
+
+// Stable sort of the data rows by the named column, numerically if all its non-empty cells are numbers
+// Empty cells sort last either way
+func sortRows(rows [][]string, col string, desc bool) error {
+	if len(rows) < 1 {
+		return nil
+	}
+	ci := indexOf(rows[0], col)
+	if ci < 0 {
+		return fmt.Errorf("no column named %q", col)
+	}
+
+	data := rows[1:]
+	numeric := true
+	for _, row := range data {
+		if _, ok := parseNumber(row[ci]); row[ci] != "" && !ok {
+			numeric = false
+			break
+		}
+	}
+
+	sort.SliceStable(data, func(i, j int) bool {
+		a, b := data[i][ci], data[j][ci]
+		if a == "" || b == "" {
+			return a != "" && b == ""
+		}
+		if numeric {
+			x, _ := parseNumber(a)
+			y, _ := parseNumber(b)
+			if desc {
+				return x > y
+			}
+			return x < y
+		}
+		if desc {
+			return a > b
+		}
+		return a < b
+	})
+	return nil
+}
+
+// Keep the first head or last tail data rows of every column, keeping columns aligned
+func limitRows(mat [][]string, head, tail int, titled bool) [][]string {
+	first := 1 // 1-based position of the first data row
+	if titled {
+		first = 2
+	}
+
+	start, end := first, 0
+	if head > 0 {
+		end = first + head - 1
+	}
+	if tail > 0 {
+		nRows := 0
+		for _, col := range mat {
+			if len(col) > nRows {
+				nRows = len(col)
+			}
+		}
+		if nRows-tail+1 > start {
+			start = nRows - tail + 1
+		}
+	}
+
+	for ci := range mat {
+		mat[ci] = sliceRows(mat[ci], start, end, titled)
+	}
+	return mat
+}
+
+// Spellings of true and false recognized by -bool-as
+var boolWords = map[string]bool{"true": true, "false": false, "yes": true, "no": false, "1": true, "0": false}
+
+// Parse comma-separated COL:TYPE expressions, returning the columns in order and the type of each
+func parseCasts(s string) ([]string, map[string]string, error) {
+	var cols []string
+	types := make(map[string]string)
+	for _, c := range strings.Split(s, ",") {
+		i := strings.LastIndex(c, ":")
+		if i < 1 {
+			return nil, nil, fmt.Errorf("malformed expression %q; expected COL:TYPE", c)
+		}
+		col, typ := c[:i], c[i+1:]
+		switch typ {
+		case "int", "float", "bool":
+		default:
+			return nil, nil, fmt.Errorf("unknown type %q in %q; expected int, float, or bool", typ, c)
+		}
+		cols = append(cols, col)
+		types[col] = typ
+	}
+	return cols, types, nil
+}
+
+// JSON value of a cell as a -cast type; empty and unparseable cells are null, and only the latter report false
+func castCell(cell, typ string) (any, bool) {
+	if cell == "" {
+		return nil, true
+	}
+	switch typ {
+	case "int":
+		if f, ok := parseNumber(cell); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int64(f), true
+		}
+	case "float":
+		if f, ok := parseNumber(cell); ok {
+			return f, true
+		}
+	case "bool":
+		if b, ok := boolWords[strings.ToLower(strings.TrimSpace(cell))]; ok {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// Rewrite a column's data cells in the -bool-as format if all non-empty ones are boolean-like
+// Reports whether the column was rewritten
+func normalizeBools(col []string, titled bool, format string) bool {
+	data := col
+	if titled && len(col) > 0 {
+		data = col[1:]
+	}
+	found := false
+	for _, cell := range data {
+		if cell == "" {
+			continue
+		}
+		if _, ok := boolWords[strings.ToLower(strings.TrimSpace(cell))]; !ok {
+			return false
+		}
+		found = true
+	}
+	if !found {
+		return false
+	}
+
+	spell := map[bool]string{true: "true", false: "false"}
+	switch format {
+	case "yesno":
+		spell = map[bool]string{true: "yes", false: "no"}
+	case "10":
+		spell = map[bool]string{true: "1", false: "0"}
+	}
+	for i, cell := range data {
+		if cell != "" {
+			data[i] = spell[boolWords[strings.ToLower(strings.TrimSpace(cell))]]
+		}
+	}
+	return true
+}
+
+// Report whether a column was declared text with -text-columns
+func textColumn(name string) bool {
+	return *textCols != "" && contains(strings.Split(*textCols, ","), name)
+}
+
+// Values Excel shows in cells whose formula failed
+var errorValues = []string{"#NULL!", "#DIV/0!", "#VALUE!", "#REF!", "#NAME?", "#NUM!", "#N/A", "#GETTING_DATA", "#SPILL!", "#CALC!"}
+
+// Addresses of cells in a column holding error values
+func errorCells(colNum int, col []string) []string {
+	var cells []string
+	for ri, cell := range col {
+		if contains(errorValues, cell) {
+			axis, err := xl.CoordinatesToCellName(colNum, ri+1)
+			efatal(err, "could not build cell address")
+			cells = append(cells, axis)
+		}
+	}
+	return cells
+}
+
+// Calculate formula cells of a column in place; calc errors such as #DIV/0! are kept as their literal
+func evalColumn(xf *xl.File, sheet string, colNum int, col []string) {
+	for ri := range col {
+		axis, err := xl.CoordinatesToCellName(colNum, ri+1)
+		efatal(err, "could not build cell address for sheet", sheet)
+
+		formula, err := xf.GetCellFormula(sheet, axis)
+		if err != nil || formula == "" {
+			continue
+		}
+
+		val, err := xf.CalcCellValue(sheet, axis)
+		if err != nil {
+			if strings.HasPrefix(err.Error(), "#") {
+				col[ri] = err.Error()
+			} else {
+				notice("warn: could not calculate", sheet+"!"+axis, "keeping stored value ->", err)
+			}
+			continue
+		}
+		col[ri] = val
+	}
+}
+
+// Map every cell covered by a merged range to the range's anchor value; where ranges overlap the outermost wins
+func mergeFills(xf *xl.File, sheet string, raw bool) (map[int]map[int]string, error) {
+	merges, err := xf.GetMergeCells(sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	type area struct {
+		c1, r1, c2, r2 int
+		value          string
+	}
+	var areas []area
+	for _, m := range merges {
+		var a area
+		if a.c1, a.r1, err = xl.CellNameToCoordinates(m.GetStartAxis()); err != nil {
+			return nil, err
+		}
+		if a.c2, a.r2, err = xl.CellNameToCoordinates(m.GetEndAxis()); err != nil {
+			return nil, err
+		}
+		if a.value, err = xf.GetCellValue(sheet, m.GetStartAxis(), xl.Options{RawCellValue: raw}); err != nil {
+			return nil, err
+		}
+		areas = append(areas, a)
+	}
+
+	// Fill smaller ranges first so enclosing ones overwrite them
+	sort.SliceStable(areas, func(i, j int) bool {
+		return (areas[i].c2-areas[i].c1+1)*(areas[i].r2-areas[i].r1+1) < (areas[j].c2-areas[j].c1+1)*(areas[j].r2-areas[j].r1+1)
+	})
+
+	fills := make(map[int]map[int]string)
+	for _, a := range areas {
+		for c := a.c1; c <= a.c2; c++ {
+			if fills[c] == nil {
+				fills[c] = make(map[int]string)
+			}
+			for r := a.r1; r <= a.r2; r++ {
+				fills[c][r] = a.value
+			}
+		}
+	}
+	return fills, nil
+}
+
+// Set the cells of a column covered by merges, growing it if a merge extends past its end
+func fillMerged(col []string, fills map[int]string) []string {
+	for row, value := range fills {
+		for len(col) < row {
+			col = append(col, "")
+		}
+		col[row-1] = value
+	}
+	return col
+}
+
+// Hyperlinked cell as emitted in JSON with -hyperlinks
+type hyperlink struct {
+	Text string `json:"text"`
+	Link string `json:"link"`
+}
+
+// Position of a cell through the row filters: its row ID and its column's title, or index with -notitles
+type cellPos struct {
+	row, col string
+}
+
+// Link targets of the hyperlinked cells among the first n rows of a column, by row index
+func linkColumn(xf *xl.File, sheet string, colNum, n int) map[int]string {
+	links := make(map[int]string)
+	for ri := 0; ri < n; ri++ {
+		axis, err := xl.CoordinatesToCellName(colNum, ri+1)
+		efatal(err, "could not build cell address for sheet", sheet)
+
+		ok, target, err := xf.GetCellHyperLink(sheet, axis)
+		if err != nil || !ok {
+			continue
+		}
+		links[ri] = target
+	}
+	return links
+}
+
+// Placeholder standing in for a hyperlinked cell in JSON output until jsonCell writes it as a hyperlink
+// Cells can't hold NUL, so it never equals a cell read
+func linkPlaceholder(sheet, row, col string) string {
+	return "\x00" + sheet + "\x00" + row + "\x00" + col
+}
+
+// Replace the -sparse cells of a column's hyperlinked cells with placeholders, recording each in linked
+func sparseLinks(sheet string, colNum int, links map[int]string, cells map[string]string, linked map[string]hyperlink) {
+	for ri, target := range links {
+		axis, _ := xl.CoordinatesToCellName(colNum, ri+1)
+		if cell, ok := cells[axis]; ok {
+			token := linkPlaceholder(sheet, axis, "")
+			linked[token] = hyperlink{Text: cell, Link: target}
+			cells[axis] = token
+		}
+	}
+}
+
+// Render the hyperlinked cells of a column-major matrix, whose last column holds row IDs, and drop that column
+// Cells read as "text (link)", or with objects as placeholders recorded in linked
+func renderLinks(mat [][]string, targets map[cellPos]string, sheet string, titled, objects bool, linked map[string]hyperlink) [][]string {
+	if len(mat) == 0 {
+		return mat
+	}
+	ids := mat[len(mat)-1]
+	mat = mat[:len(mat)-1]
+	cols := mat
+	if *withIndex && len(cols) > 0 {
+		cols = cols[1:]
+	}
+	for ci, col := range cols {
+		key, first := strconv.Itoa(ci), 0
+		if titled {
+			if len(col) == 0 {
+				continue
+			}
+			key, first = col[0], 1
+		}
+		for ri := first; ri < len(col) && ri < len(ids); ri++ {
+			target, ok := targets[cellPos{ids[ri], key}]
+			if !ok {
+				continue
+			}
+			if objects {
+				token := linkPlaceholder(sheet, ids[ri], key)
+				linked[token] = hyperlink{Text: col[ri], Link: target}
+				col[ri] = token
+			} else {
+				col[ri] += " (" + target + ")"
+			}
+		}
+	}
+	return mat
+}
+
+// Formatting of a cell as reported by -styles
+type cellStyle struct {
+	Fill   string `json:"fill,omitempty"` // ARGB hex, or "theme:N" or "indexed:N" for palette colors
+	Bold   bool   `json:"bold,omitempty"`
+	Italic bool   `json:"italic,omitempty"`
+}
+
+// Record the fill and font of each styled cell of a column, omitting cells with the default look
+// The table holds the look of each style index, as from styleTable
+func styleColumn(xf *xl.File, sheet string, colNum int, col []string, table []cellStyle, styles map[string]cellStyle) {
+	for ri := range col {
+		axis, err := xl.CoordinatesToCellName(colNum, ri+1)
+		efatal(err, "could not build cell address for sheet", sheet)
+
+		id, err := xf.GetCellStyle(sheet, axis)
+		if err != nil || id <= 0 || id >= len(table) {
+			continue
+		}
+		if style := table[id]; style != (cellStyle{}) {
+			styles[axis] = style
+		}
+	}
+}
+
+// The look of each cell style index of a workbook
+func styleTable(xf *xl.File) []cellStyle {
+	if xf.Styles == nil || xf.Styles.CellXfs == nil {
+		return nil
+	}
+	table := make([]cellStyle, len(xf.Styles.CellXfs.Xf))
+	for id := range table {
+		table[id] = resolveStyle(xf, id)
+	}
+	return table
+}
+
+// Look up the fill color and font weight/slant of a cell style index
+func resolveStyle(xf *xl.File, id int) cellStyle {
+	var style cellStyle
+	if xf.Styles == nil || xf.Styles.CellXfs == nil || id < 0 || id >= len(xf.Styles.CellXfs.Xf) {
+		return style
+	}
+	x := xf.Styles.CellXfs.Xf[id]
+
+	if x.FillID != nil && xf.Styles.Fills != nil && *x.FillID < len(xf.Styles.Fills.Fill) {
+		fill := xf.Styles.Fills.Fill[*x.FillID]
+		if p := fill.PatternFill; p != nil && p.PatternType != "" && p.PatternType != "none" && p.FgColor != nil {
+			switch c := p.FgColor; {
+			case c.RGB != "":
+				style.Fill = c.RGB
+			case c.Theme != nil:
+				style.Fill = "theme:" + strconv.Itoa(*c.Theme)
+			case c.Indexed != 0:
+				style.Fill = "indexed:" + strconv.Itoa(c.Indexed)
+			}
+		}
+	}
+
+	if x.FontID != nil && xf.Styles.Fonts != nil && *x.FontID < len(xf.Styles.Fonts.Font) {
+		font := xf.Styles.Fonts.Font[*x.FontID]
+		style.Bold = font.B != nil && (font.B.Val == nil || *font.B.Val)
+		style.Italic = font.I != nil && (font.I.Val == nil || *font.I.Val)
+	}
+	return style
+}
+
+// Title of a column whose title spans len(upper)+1 rows from row first, joined by sep
+// Empty upper cells repeat the last non-empty one to their left, as in a merged cell; upper carries those between columns
+func mergedTitle(col []string, first int, upper []string, sep string) string {
+	var parts []string
+	for k := 0; k <= len(upper); k++ {
+		cell := ""
+		if first+k < len(col) {
+			cell = col[first+k]
+		}
+		if k < len(upper) {
+			if cell == "" {
+				cell = upper[k]
+			} else {
+				upper[k] = cell
+			}
+		}
+		if cell != "" {
+			parts = append(parts, cell)
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// Replace a sheet with an empty one of the same name, added last
+func replaceSheet(xf *xl.File, name string) {
+	// Renaming first lets the new sheet be added before the old is deleted, as the last sheet can't be
+	old := "~old"
+	for xf.GetSheetIndex(old) >= 0 {
+		old += "_"
+	}
+	xf.SetSheetName(name, old)
+	xf.NewSheet(name)
+	xf.DeleteSheet(old)
+}
+
+// Record the non-empty cells of a column within the area, if any, by address
+func sparseColumn(colNum int, col []string, area *cellArea, cells map[string]string) {
+	for ri, cell := range col {
+		if cell == "" || (area != nil && (ri+1 < area.r1 || ri+1 > area.r2)) {
+			continue
+		}
+		axis, _ := xl.CoordinatesToCellName(colNum, ri+1)
+		cells[axis] = cell
+	}
+}
+
+// Append comments to the cells of a column in place as "text (comment)"
+func commentColumn(colNum int, col []string, comments map[string]string) {
+	for ri := range col {
+		axis, _ := xl.CoordinatesToCellName(colNum, ri+1)
+		if comment, ok := comments[axis]; ok {
+			col[ri] += " (" + comment + ")"
+		}
+	}
+}
+
+// Built-in number formats which display dates or times
+var dateNumFmts = map[int]bool{
+	14: true, 15: true, 16: true, 17: true, 18: true, 19: true, 20: true, 21: true, 22: true,
+	27: true, 28: true, 29: true, 30: true, 31: true, 32: true, 33: true, 34: true, 35: true, 36: true,
+	45: true, 46: true, 47: true,
+	50: true, 51: true, 52: true, 53: true, 54: true, 55: true, 56: true, 57: true, 58: true,
+}
+
+// Quoted text, [colour]/[$-locale] sections, and escaped characters in a number format
+var fmtLiterals = regexp.MustCompile(`"[^"]*"|\[[^]]*\]|\\.`)
+
+// Report whether a style displays its number as a date or time
+func isDateStyle(xf *xl.File, style int) bool {
+	if xf.Styles == nil || xf.Styles.CellXfs == nil || style < 0 || style >= len(xf.Styles.CellXfs.Xf) {
+		return false
+	}
+	id := xf.Styles.CellXfs.Xf[style].NumFmtID
+	if id == nil {
+		return false
+	}
+	if dateNumFmts[*id] {
+		return true
+	}
+	if xf.Styles.NumFmts == nil {
+		return false
+	}
+
+	for _, nf := range xf.Styles.NumFmts.NumFmt {
+		if nf.NumFmtID != *id {
+			continue
+		}
+		// Ignore literal text and [colour]/[$-locale] sections before looking for date tokens
+		code := fmtLiterals.ReplaceAllString(nf.FormatCode, "")
+		return strings.ContainsAny(strings.ToLower(code), "ydhs")
+	}
+	return false
+}
+
+// Convert date-formatted numeric cells of a column in place to the given layout
+func convertDates(xf *xl.File, sheet string, colNum int, col []string, layout string) {
+	date1904 := xf.WorkBook != nil && xf.WorkBook.WorkbookPr != nil && xf.WorkBook.WorkbookPr.Date1904
+	for ri := range col {
+		axis, err := xl.CoordinatesToCellName(colNum, ri+1)
+		efatal(err, "could not build cell address for sheet", sheet)
+
+		style, err := xf.GetCellStyle(sheet, axis)
+		if err != nil || !isDateStyle(xf, style) {
+			continue
+		}
+
+		raw, err := xf.GetCellValue(sheet, axis, xl.Options{RawCellValue: true})
+		if err != nil {
+			continue
+		}
+		// Raw values are never localized
+		serial, ok := parseFloat(raw)
+		if !ok {
+			continue
+		}
+		t, err := xl.ExcelDateToTime(serial, date1904)
+		if err != nil {
+			continue
+		}
+		col[ri] = t.Format(layout)
+	}
+}
+
+// Report whether f is a terminal rather than a pipe, file, or other device such as /dev/null
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// List sheets on stderr and read the one to use from stdin by number or name; empty input or EOF picks def
+func promptSheet(sheets []string, def string) string {
+	for i, sheet := range sheets {
+		mark := " "
+		if sheet == def {
+			mark = "*"
+		}
+		fmt.Fprintf(os.Stderr, "%s %d) %s\n", mark, i+1, sheet)
+	}
+
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Fprintf(os.Stderr, "sheet [%s]: ", def)
+		if !in.Scan() {
+			fmt.Fprintln(os.Stderr)
+			return def
+		}
+
+		answer := strings.TrimSpace(in.Text())
+		if answer == "" {
+			return def
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(sheets) {
+			return sheets[n-1]
+		}
+		for _, sheet := range sheets {
+			if sheet == answer {
+				return sheet
+			}
+		}
+		fmt.Fprintln(os.Stderr, "no such sheet:", answer)
+	}
+}
+
+// GET a URL and return its body, failing on any non-200 response
+func fetch(url string, headers []string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed header %q; expected 'Name: value'", h)
+		}
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Create a JSON encoder indenting by n spaces, or compact if n is 0
+func jsonEncoder(w io.Writer, n int) *json.Encoder {
+	enc := json.NewEncoder(w)
+	if n > 0 {
+		enc.SetIndent("", strings.Repeat(" ", n))
+	}
+	return enc
+}
+
+// JSON encode a map of sheet→maps and slices of cells; conv, if set, chooses each cell's JSON form
+func encodeCells(enc *json.Encoder, v any, conv func(sheet, key, cell string) any) error {
+	if conv == nil {
+		return enc.Encode(v)
+	}
+	return enc.Encode(convertCells(reflect.ValueOf(v), "", "", conv))
+}
+
+// Rebuild maps and slices replacing each string with conv(sheet, key, cell)
+// The sheet is the outermost map key above the cell and key the innermost
+func convertCells(v reflect.Value, sheet, key string, conv func(sheet, key, cell string) any) any {
+	switch v.Kind() {
+	case reflect.Map:
+		m := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k := iter.Key().String()
+			if sheet == "" {
+				m[k] = convertCells(iter.Value(), k, k, conv)
+				continue
+			}
+			m[k] = convertCells(iter.Value(), sheet, k, conv)
+		}
+		return m
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		s := make([]any, v.Len())
+		for i := range s {
+			s[i] = convertCells(v.Index(i), sheet, key, conv)
+		}
+		return s
+	case reflect.Interface:
+		return convertCells(v.Elem(), sheet, key, conv)
+	case reflect.String:
+		return conv(sheet, key, v.String())
+	}
+	return v.Interface()
+}
+
+// Convert the cells of a column-major matrix by conv, keyed by their column's first cell; titles are kept as they are
+func matrixCells(mat [][]string, sheet string, titled bool, conv func(sheet, key, cell string) any) [][]any {
+	if mat == nil {
+		return nil
+	}
+	cols := make([][]any, len(mat))
+	for ci, col := range mat {
+		cols[ci] = make([]any, len(col))
+		for ri, cell := range col {
+			if ri == 0 && titled {
+				cols[ci][ri] = cell
+				continue
+			}
+			cols[ci][ri] = conv(sheet, col[0], cell)
+		}
+	}
+	return cols
+}
+
+// Build one record per row keyed by column name; short columns are filled with empty strings
+func tabRecords(names []string, tab map[string][]string) []map[string]string {
+	rows := tabRows(names, tab)
+	records := make([]map[string]string, 0, len(rows))
+	for _, row := range rows {
+		record := make(map[string]string, len(names))
+		for ci, name := range names {
+			record[name] = row[ci]
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// JSON object of a row whose keys keep their order, with cells converted by conv if set
+type orderedRecord struct {
+	keys, vals []string
+	conv       func(key, cell string) any
+}
+
+func (r orderedRecord) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	err := writeObject(&b, r.keys, r.vals, r.conv)
+	return b.Bytes(), err
+}
+
+// Build one record per row with keys in -order order; short columns are filled with empty strings
+func orderedRecords(names []string, tab map[string][]string, conv func(key, cell string) any) []orderedRecord {
+	rows := tabRows(names, tab)
+	records := make([]orderedRecord, 0, len(rows))
+	for _, row := range rows {
+		keys, vals := orderKeys(names, row)
+		records = append(records, orderedRecord{keys, vals, conv})
+	}
+	return records
+}
+
+// Keys of a record and their cells in -order order: as the columns are, or sorted by key
+func orderKeys(keys, vals []string) ([]string, []string) {
+	if *keyOrder != "sorted" {
+		return keys, vals
+	}
+	idx := make([]int, len(keys))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return keys[idx[a]] < keys[idx[b]] })
+
+	sk, sv := make([]string, len(idx)), make([]string, len(idx))
+	for i, k := range idx {
+		sk[i], sv[i] = keys[k], vals[k]
+	}
+	return sk, sv
+}
+
+// Per-column statistics for Stats mode; min, max, and mean are only set for columns with numbers
+type colStats struct {
+	Name  string `json:"name"`
+	Index int    `json:"index"` // 0-based position among the sheet's columns
+	Rows  int    `json:"rows"`  // Data cells, empty included
+
+	Count    int      `json:"count"`   // Non-empty cells
+	Numeric  int      `json:"numeric"` // Cells parsing as numbers
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Mean     *float64 `json:"mean,omitempty"`
+	Distinct int      `json:"distinct"` // Distinct non-empty values
+	Missing  int      `json:"missing"`  // Empty cells
+
+	Types    map[string]int `json:"types"`          // Non-empty cells per inferred type
+	Type     string         `json:"type,omitempty"` // Dominant type
+	Mismatch int            `json:"mismatch"`       // Non-empty cells not of the dominant type
+}
+
+// Column statistics of a sheet, in column order
+type sheetStats struct {
+	Columns  []*colStats `json:"columns"`
+	RowCount int         `json:"rowCount"` // Data rows of the longest column
+	ColCount int         `json:"colCount"`
+}
+
+func (st *colStats) String() string {
+	s := fmt.Sprint("count: ", st.Count, " numeric: ", st.Numeric)
+	if st.Numeric > 0 {
+		s += fmt.Sprint(" min: ", *st.Min, " max: ", *st.Max, " mean: ", *st.Mean)
+	}
+	s += fmt.Sprint(" distinct: ", st.Distinct, " missing: ", st.Missing)
+	if st.Type != "" {
+		s += fmt.Sprint(" type: ", st.Type, " mismatch: ", st.Mismatch)
+	}
+	return s
+}
+
+// Profile the data cells of a column
+func columnStats(data []string) *colStats {
+	st := &colStats{Rows: len(data), Types: make(map[string]int)}
+	seen := make(map[string]bool)
+	var min, max, sum float64
+	for _, cell := range data {
+		if cell == "" {
+			st.Missing++
+			continue
+		}
+		st.Count++
+		st.Types[cellType(cell)]++
+		if !seen[cell] {
+			seen[cell] = true
+			st.Distinct++
+		}
+
+		f, ok := parseNumber(cell)
+		if !ok {
+			continue
+		}
+		if st.Numeric == 0 || f < min {
+			min = f
+		}
+		if st.Numeric == 0 || f > max {
+			max = f
+		}
+		sum += f
+		st.Numeric++
+	}
+
+	if st.Numeric > 0 {
+		mean := sum / float64(st.Numeric)
+		st.Min, st.Max, st.Mean = &min, &max, &mean
+	}
+
+	// Ints are floats too, so they count toward a float column; ties go to the narrower type
+	fits := func(typ string) int {
+		if typ == "float" {
+			return st.Types["int"] + st.Types["float"]
+		}
+		return st.Types[typ]
+	}
+	for _, typ := range cellTypes {
+		if fits(typ) > fits(st.Type) {
+			st.Type = typ
+		}
+	}
+	st.Mismatch = st.Count - fits(st.Type)
+	return st
+}
+
+// JSON Schema of an array of records, typing each property by the inferred types of its cells
+// Properties are required when none of their cells are empty
+func recordsSchema(names []string, tab map[string][]string) map[string]any {
+	props := make(map[string]any)
+	required := []string{}
+	for _, name := range names {
+		st := columnStats(tab[name])
+		typ := "string"
+		switch {
+		case textColumn(name):
+		case st.Count > 0 && st.Types["int"] == st.Count:
+			typ = "integer"
+		case st.Count > 0 && st.Types["int"]+st.Types["float"] == st.Count:
+			typ = "number"
+		case st.Count > 0 && st.Types["bool"] == st.Count:
+			typ = "boolean"
+		}
+		props[name] = map[string]any{"type": typ}
+		if st.Count > 0 && st.Missing == 0 {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]any{
+		"type": "array",
+		"items": map[string]any{
+			"type":       "object",
+			"properties": props,
+			"required":   required,
+		},
+	}
+}
+
+// Separate a column's name from its data cells; untitled columns are named by letter
+func splitTitle(ci int, col []string, titled bool) (string, []string) {
+	if !titled {
+		name, _ := xl.ColumnNumberToName(ci + 1)
+		return name, col
+	}
+	if len(col) < 1 {
+		return "", nil
+	}
+	return col[0], col[1:]
+}
+
+// Parse a cell as a finite number, written with the -decimal-sep and -thousands-sep separators
+func parseNumber(cell string) (float64, bool) {
+	if *decimalSep != "." || *thousandsSep != "" {
+		var ok bool
+		if cell, ok = delocalize(cell, *decimalSep, *thousandsSep); !ok {
+			return 0, false
+		}
+	}
+	return parseFloat(cell)
+}
+
+// Rewrite a number using the given separators with a '.' decimal point and no grouping
+// Grouped digits must come in threes, and a '.' other than a separator isn't a number
+func delocalize(cell, decimal, thousands string) (string, bool) {
+	sign := ""
+	if strings.HasPrefix(cell, "-") || strings.HasPrefix(cell, "+") {
+		sign, cell = cell[:1], cell[1:]
+	}
+	whole, frac, hasFrac := strings.Cut(cell, decimal)
+	if thousands != "" && strings.Contains(whole, thousands) {
+		groups := strings.Split(whole, thousands)
+		if len(groups[0]) < 1 || len(groups[0]) > 3 {
+			return "", false
+		}
+		for _, group := range groups[1:] {
+			if len(group) != 3 {
+				return "", false
+			}
+		}
+		whole = strings.Join(groups, "")
+	}
+	if decimal != "." && (strings.Contains(whole, ".") || strings.Contains(frac, ".")) {
+		return "", false
+	}
+	if hasFrac {
+		whole += "." + frac
+	}
+	return sign + whole, true
+}
+
+// Parse a Go-syntax float as a finite number
+func parseFloat(cell string) (float64, bool) {
+	f, err := strconv.ParseFloat(cell, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+// Types reported by cellType, narrowest first
+var cellTypes = []string{"int", "float", "bool", "date", "string"}
+
+// Layouts recognized as dates by cellType
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"01-02-06",
+	"1/2/06",
+	"1/2/2006",
+	"02-Jan-06",
+	"2-Jan-2006",
+	"Jan 2, 2006",
+}
+
+// Imports needed by generated Go files; the literals use only builtin types so far
+var goImports []string
+
+// Start of a generated Go file: package clause and imports when pkg is set, then decl
+func goHeader(pkg, decl string) []byte {
+	var b bytes.Buffer
+	if pkg != "" {
+		fmt.Fprintf(&b, "package %s\n\n", pkg)
+		if len(goImports) > 0 {
+			fmt.Fprintln(&b, "import (")
+			for _, imp := range goImports {
+				fmt.Fprintf(&b, "\t%s\n", strconv.Quote(imp))
+			}
+			fmt.Fprintln(&b, ")")
+			fmt.Fprintln(&b)
+		}
+	}
+	b.WriteString(decl)
+	return b.Bytes()
+}
+
+// Build a Go composite literal of maps, slices, and strings with one element per line, for gofmt to indent
+func goLiteral(v any) []byte {
+	var b bytes.Buffer
+	val := reflect.ValueOf(v)
+	b.WriteString(val.Type().String())
+	writeGoLiteral(&b, val)
+	return b.Bytes()
+}
+
+// Write the body of a composite literal; inner types are elided
+func writeGoLiteral(b *bytes.Buffer, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		b.WriteString("{\n")
+		for _, k := range keys {
+			b.WriteString(strconv.Quote(k.String()) + ": ")
+			writeGoLiteral(b, v.MapIndex(k))
+			b.WriteString(",\n")
+		}
+		b.WriteString("}")
+	case reflect.Slice:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		if v.Type().Elem().Kind() == reflect.String {
+			// Innermost slices stay on one line
+			b.WriteString("{")
+			for i := 0; i < v.Len(); i++ {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				b.WriteString(strconv.Quote(v.Index(i).String()))
+			}
+			b.WriteString("}")
+			return
+		}
+		b.WriteString("{\n")
+		for i := 0; i < v.Len(); i++ {
+			writeGoLiteral(b, v.Index(i))
+			b.WriteString(",\n")
+		}
+		b.WriteString("}")
+	case reflect.String:
+		b.WriteString(strconv.Quote(v.String()))
+	default:
+		fmt.Fprintf(b, "%#v", v.Interface())
+	}
+}
+
+// Classify a cell value as "int", "float", "bool", "date", or "string"
+func cellType(cell string) string {
+	if _, err := strconv.ParseInt(cell, 10, 64); err == nil {
+		return "int"
+	}
+	if _, ok := parseNumber(cell); ok {
+		return "float"
+	}
+	if strings.EqualFold(cell, "true") || strings.EqualFold(cell, "false") {
+		return "bool"
+	}
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, cell); err == nil {
+			return "date"
+		}
+	}
+	return "string"
+}
+
+// Infer the Go type of a column from its non-empty values; mixed columns are strings
+func goType(values []string) string {
+	typ := ""
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		t := cellType(v)
+		switch {
+		case typ == "" || typ == t:
+			typ = t
+		case typ == "int" && t == "float", typ == "float" && t == "int":
+			typ = "float"
+		default:
+			return "string"
+		}
+	}
+
+	switch typ {
+	case "int":
+		return "int"
+	case "float":
+		return "float64"
+	case "bool":
+		return "bool"
+	}
+	return "string"
+}
+
+// Convert a title to an exported Go identifier, e.g. "unit price" → "UnitPrice"
+func goIdent(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+
+	ident := b.String()
+	if ident == "" {
+		return ""
+	}
+	if r, _ := utf8.DecodeRuneInString(ident); !unicode.IsUpper(r) {
+		// Digits and uncased letters can't start an exported name
+		ident = "X" + ident
+	}
+	return ident
+}
+
+// Build Go source declaring a struct type for a sheet and a slice literal, typeName + "Rows", holding its rows
+func goStruct(typeName string, names []string, tab map[string][]string) []byte {
+	fields := make([]string, len(names))
+	types := make([]string, len(names))
+	seen := make(map[string]bool)
+	for i, name := range names {
+		field := goIdent(name)
+		if field == "" {
+			field = "Col" + strconv.Itoa(i)
+		}
+		for base, n := field, 2; seen[field]; n++ {
+			field = base + strconv.Itoa(n)
+		}
+		seen[field] = true
+		fields[i] = field
+		types[i] = goType(tab[name])
+		if textColumn(name) {
+			types[i] = "string"
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "type %s struct {\n", typeName)
+	for i, name := range names {
+		tag := "`json:" + strconv.Quote(name) + "`"
+		if strings.Contains(name, "`") {
+			// A raw string can't hold a backtick, so quote the tag instead
+			tag = strconv.Quote("json:" + strconv.Quote(name))
+		}
+		fmt.Fprintf(&b, "%s %s %s\n", fields[i], types[i], tag)
+	}
+	fmt.Fprintln(&b, "}")
+	fmt.Fprintln(&b)
+
+	fmt.Fprintf(&b, "var %sRows = []%s{\n", typeName, typeName)
+	for _, row := range tabRows(names, tab) {
+		var vals []string
+		for i, cell := range row {
+			if cell == "" {
+				// Leave empty cells as the zero value
+				continue
+			}
+			val := strconv.Quote(cell)
+			switch types[i] {
+			case "int":
+				n, _ := strconv.ParseInt(cell, 10, 64)
+				val = strconv.FormatInt(n, 10)
+			case "float64":
+				f, _ := parseNumber(cell)
+				val = strconv.FormatFloat(f, 'g', -1, 64)
+			case "bool":
+				val = strings.ToLower(cell)
+			}
+			vals = append(vals, fields[i]+": "+val)
+		}
+		fmt.Fprintf(&b, "{%s},\n", strings.Join(vals, ", "))
+	}
+	fmt.Fprintln(&b, "}")
+
+	return b.Bytes()
+}
+
+// Build an INSERT statement for one row; identifiers are double-quoted and values single-quoted
+func sqlInsert(table string, names, row []string, nullEmpty bool) string {
+	ident := func(s string) string {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+
+	cols := make([]string, len(names))
+	for i, name := range names {
+		cols[i] = ident(name)
+	}
+
+	vals := make([]string, len(row))
+	for i, cell := range row {
+		if nullEmpty && cell == "" {
+			vals[i] = "NULL"
+			continue
+		}
+		vals[i] = "'" + strings.ReplaceAll(cell, "'", "''") + "'"
+	}
+
+	return "INSERT INTO " + ident(table) + " (" + strings.Join(cols, ", ") + ") VALUES (" + strings.Join(vals, ", ") + ");"
+}
+
+// Write rows as a box-drawing table for terminals, cells cut to max runes with … if max > 0
+// Titles are ruled off from the data; line breaks and tabs in cells are shown as ↵ and spaces
+func writePretty(w io.Writer, rows [][]string, titled bool, max int) {
+	if len(rows) < 1 {
+		return
+	}
+
+	cells := make([][]string, len(rows))
+	widths := make([]int, len(rows[0]))
+	for ri, row := range rows {
+		cells[ri] = make([]string, len(row))
+		for ci, cell := range row {
+			cell = strings.NewReplacer("\r\n", "↵", "\n", "↵", "\t", " ").Replace(cell)
+			if max > 0 && utf8.RuneCountInString(cell) > max {
+				cell = string([]rune(cell)[:max-1]) + "…"
+			}
+			cells[ri][ci] = cell
+			if n := utf8.RuneCountInString(cell); n > widths[ci] {
+				widths[ci] = n
+			}
+		}
+	}
+
+	rule := func(left, mid, right string) {
+		parts := make([]string, len(widths))
+		for ci, n := range widths {
+			parts[ci] = strings.Repeat("─", n+2)
+		}
+		fmt.Fprintln(w, left+strings.Join(parts, mid)+right)
+	}
+
+	rule("┌", "┬", "┐")
+	for ri, row := range cells {
+		fmt.Fprint(w, "│")
+		for ci, cell := range row {
+			fmt.Fprint(w, " ", cell, strings.Repeat(" ", widths[ci]-utf8.RuneCountInString(cell)), " │")
+		}
+		fmt.Fprintln(w)
+		if ri == 0 && titled && len(cells) > 1 {
+			rule("├", "┼", "┤")
+		}
+	}
+	rule("└", "┴", "┘")
+}
+
+// Write rows as a Markdown table; without titles an empty header row is emitted as tables require one
+func writeMarkdown(w io.Writer, rows [][]string, titled bool) {
+	if len(rows) < 1 {
+		return
+	}
+	nCols := len(rows[0])
+
+	header := make([]string, nCols)
+	if titled {
+		header = rows[0]
+		rows = rows[1:]
+	}
+
+	line := func(cells []string) {
+		fmt.Fprint(w, "|")
+		for _, cell := range cells {
+			cell = strings.ReplaceAll(cell, "|", `\|`)
+			cell = strings.ReplaceAll(cell, "\r\n", "<br>")
+			cell = strings.ReplaceAll(cell, "\n", "<br>")
+			fmt.Fprint(w, " ", cell, " |")
+		}
+		fmt.Fprintln(w)
+	}
+
+	line(header)
+	fmt.Fprintln(w, "|"+strings.Repeat(" --- |", nCols))
+	for _, row := range rows {
+		line(row)
+	}
+}
+
+// Write rows as an HTML table, escaping every cell
+func writeHTML(w io.Writer, rows [][]string, titled bool) {
+	line := func(cells []string, tag string) {
+		fmt.Fprint(w, "<tr>")
+		for _, cell := range cells {
+			fmt.Fprintf(w, "<%s>%s</%s>", tag, html.EscapeString(cell), tag)
+		}
+		fmt.Fprintln(w, "</tr>")
+	}
+
+	fmt.Fprintln(w, `<table class="xl-table">`)
+	if titled && len(rows) > 0 {
+		fmt.Fprintln(w, "<thead>")
+		line(rows[0], "th")
+		fmt.Fprintln(w, "</thead>")
+		rows = rows[1:]
+	}
+	fmt.Fprintln(w, "<tbody>")
+	for _, row := range rows {
+		line(row, "td")
+	}
+	fmt.Fprintln(w, "</tbody>")
+	fmt.Fprintln(w, "</table>")
+}
+
+// Write a compact JSON object with keys in the given order; conv, if set, chooses each value's JSON form
+func writeObject(w io.Writer, keys, vals []string, conv func(key, cell string) any) error {
+	buf := []byte{'{'}
+	for i, key := range keys {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		var val any = vals[i]
+		if conv != nil {
+			val = conv(key, vals[i])
+		}
+		v, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, k...)
+		buf = append(buf, ':')
+		buf = append(buf, v...)
+	}
+	buf = append(buf, '}')
+	_, err := w.Write(buf)
+	return err
+}
+
+// Build a YAML mapping of sheet→matrix, keeping sheets in workbook order
+func yamlMat(sheets []string, mat map[string][][]string) (*yaml.Node, error) {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, sheet := range sheets {
+		val := &yaml.Node{}
+		cols := mat[sheet]
+		if cols == nil {
+			cols = [][]string{}
+		}
+		if err := val.Encode(cols); err != nil {
+			return nil, err
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: sheet}, val)
+	}
+	return doc, nil
+}
+
+// Build a YAML mapping of sheet→column→values, keeping sheets and columns in their original order
+func yamlTab(sheets []string, names map[string][]string, tab map[string]map[string][]string) (*yaml.Node, error) {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, sheet := range sheets {
+		cols := &yaml.Node{Kind: yaml.MappingNode}
+		for _, name := range names[sheet] {
+			val := &yaml.Node{}
+			values := tab[sheet][name]
+			if values == nil {
+				// Empty columns render as [] rather than null
+				values = []string{}
+			}
+			if err := val.Encode(values); err != nil {
+				return nil, err
+			}
+			cols.Content = append(cols.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, val)
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: sheet}, cols)
+	}
+	return doc, nil
+}
+
+func efatal(err error, s ...any) {
+	efatalCode(exitFailure, err, s...)
+}
+
+func efatalCode(code int, err error, s ...any) {
+	if err == nil {
+		return
+	}
+	var msg []any = []any{"err:"}
+	msg = append(msg, s...)
+	msg = append(msg, "->", err.Error())
+	fatalCode(code, msg...)
+}
+
+// Version of the excelize module in this binary
+func excelizeVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == "github.com/xuri/excelize/v2" {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+// Print an info or warning line to stderr unless -quiet
+func notice(s ...any) {
+	if *quiet {
+		return
+	}
+	fmt.Fprintln(os.Stderr, s...)
+}
+
+func fatal(s ...any) {
+	fatalCode(exitFailure, s...)
+}
+
+func fatalCode(code int, s ...any) {
 	fmt.Fprintln(os.Stderr, s...)
-	os.Exit(1)
+	os.Exit(code)
 }
@@ -0,0 +1,1597 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	xl "github.com/xuri/excelize/v2"
+)
+
+// Set in the environment of the test binary run as xl by run
+const mainArgs = "XL_TEST_ARGS"
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv(mainArgs); ok {
+		// Run as the command, with the JSON-encoded arguments
+		var list []string
+		if err := json.Unmarshal([]byte(args), &list); err != nil {
+			panic(err)
+		}
+		os.Args = append([]string{"xl"}, list...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// Command running xl with args
+// The test binary runs itself, so a -race build checks the command too
+func command(t *testing.T, args ...string) *exec.Cmd {
+	t.Helper()
+	list, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), mainArgs+"="+string(list))
+	return cmd
+}
+
+// Run xl with args and stdin, returning its stdout, stderr, and exit error
+func run(t *testing.T, stdin string, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := command(t, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// Like run, but fail the test if xl fails
+func mustRun(t *testing.T, stdin string, args ...string) string {
+	t.Helper()
+	stdout, stderr, err := run(t, stdin, args...)
+	if err != nil {
+		t.Fatalf("xl %s: %v\n%s", strings.Join(args, " "), err, stderr)
+	}
+	return stdout
+}
+
+// A sheet of a test workbook
+type sheetData struct {
+	name string
+	rows [][]any
+}
+
+// Write a workbook of sheets, in order, to a temporary file and return its path
+func workbook(t *testing.T, sheets ...sheetData) string {
+	t.Helper()
+	f := xl.NewFile()
+	for i, sheet := range sheets {
+		if i == 0 {
+			f.SetSheetName(f.GetSheetName(0), sheet.name)
+		} else {
+			f.NewSheet(sheet.name)
+		}
+		for ri, row := range sheet.rows {
+			cell, err := xl.CoordinatesToCellName(1, ri+1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			row := row
+			if err := f.SetSheetRow(sheet.name, cell, &row); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "book.xlsx")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// People with their age and city, for the row filter tests
+func people(t *testing.T) string {
+	return workbook(t, sheetData{"People", [][]any{
+		{"Name", "Age", "City"},
+		{"Alice", 30, "Paris"},
+		{"Bob", 25, "Berlin"},
+		{"Carol", 41, "Rome"},
+	}})
+}
+
+// Check each case's output of xl run with its args after common ones
+func checkOutputs(t *testing.T, common []string, cases map[string]string) {
+	t.Helper()
+	for args, want := range cases {
+		all := append(append([]string{}, common...), strings.Fields(args)...)
+		if got := mustRun(t, "", all...); got != want {
+			t.Errorf("xl %s: got %q, want %q", strings.Join(all, " "), got, want)
+		}
+	}
+}
+
+func TestTSV(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Name", "Note"}, {"Alice", "a\tb"}, {"Bob", "plain"}}})
+	checkOutputs(t, []string{"-i", book}, map[string]string{
+		"-tsv": "Name\tNote\nAlice\t\"a\tb\"\nBob\tplain\n",
+	})
+}
+
+// Two people with alphabetically ordered titles
+func pair(t *testing.T) string {
+	return workbook(t, sheetData{"Sheet1", [][]any{{"City", "Name"}, {"Paris", "Alice"}, {"Rome", "Bob"}}})
+}
+
+func TestYAML(t *testing.T) {
+	checkOutputs(t, []string{"-i", pair(t)}, map[string]string{
+		"-yaml":        "Sheet1:\n    City:\n        - Paris\n        - Rome\n    Name:\n        - Alice\n        - Bob\n",
+		"-yaml -table": "Sheet1:\n    - - City\n      - Paris\n      - Rome\n    - - Name\n      - Alice\n      - Bob\n",
+	})
+}
+
+func TestNDJSON(t *testing.T) {
+	checkOutputs(t, []string{"-i", pair(t)}, map[string]string{
+		"-ndjson": "{\"City\":\"Paris\",\"Name\":\"Alice\"}\n{\"City\":\"Rome\",\"Name\":\"Bob\"}\n",
+	})
+	book := workbook(t,
+		sheetData{"A", [][]any{{"X"}, {"1"}}},
+		sheetData{"B", [][]any{{"Y"}, {"2"}}},
+	)
+	checkOutputs(t, []string{"-i", book}, map[string]string{
+		"-ndjson -all": "{\"_sheet\":\"A\",\"X\":\"1\"}\n{\"_sheet\":\"B\",\"Y\":\"2\"}\n",
+	})
+}
+
+func TestRecords(t *testing.T) {
+	checkOutputs(t, []string{"-i", pair(t)}, map[string]string{
+		"-records": `[{"City":"Paris","Name":"Alice"},{"City":"Rome","Name":"Bob"}]` + "\n",
+	})
+	if _, stderr, err := run(t, "", "-records", "-notitles", "-i", pair(t)); err == nil || !strings.Contains(stderr, "requires column names") {
+		t.Errorf("-records -notitles: want a column names error, got %v: %s", err, stderr)
+	}
+}
+
+// Cells that need escaping in markup and SQL, and an empty cell
+func tricky(t *testing.T) string {
+	return workbook(t, sheetData{"Sheet1", [][]any{{"Name", "Note"}, {"O'Neil", "a|b"}, {"<b>", ""}}})
+}
+
+func TestMarkdown(t *testing.T) {
+	checkOutputs(t, []string{"-i", tricky(t)}, map[string]string{
+		"-markdown": "| Name | Note |\n| --- | --- |\n| O'Neil | a\\|b |\n| <b> |  |\n",
+	})
+}
+
+func TestHTML(t *testing.T) {
+	checkOutputs(t, []string{"-i", tricky(t)}, map[string]string{
+		"-html": "<table class=\"xl-table\">\n<thead>\n<tr><th>Name</th><th>Note</th></tr>\n</thead>\n<tbody>\n<tr><td>O&#39;Neil</td><td>a|b</td></tr>\n<tr><td>&lt;b&gt;</td><td></td></tr>\n</tbody>\n</table>\n",
+	})
+}
+
+func TestSQL(t *testing.T) {
+	checkOutputs(t, []string{"-i", tricky(t)}, map[string]string{
+		"-sql":                                   "INSERT INTO \"Sheet1\" (\"Name\", \"Note\") VALUES ('O''Neil', 'a|b');\nINSERT INTO \"Sheet1\" (\"Name\", \"Note\") VALUES ('<b>', '');\n",
+		"-sql -sql-table people -sql-null-empty": "INSERT INTO \"people\" (\"Name\", \"Note\") VALUES ('O''Neil', 'a|b');\nINSERT INTO \"people\" (\"Name\", \"Note\") VALUES ('<b>', NULL);\n",
+	})
+}
+
+func TestTOML(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Unit price", "Name"}, {"3", "pen"}}})
+	checkOutputs(t, []string{"-i", book}, map[string]string{
+		"-toml": "Name = [\"pen\"]\n\"Unit price\" = [\"3\"]\n",
+	})
+}
+
+func TestIndent(t *testing.T) {
+	checkOutputs(t, []string{"-i", pair(t)}, map[string]string{
+		"-json":           "{\"Sheet1\":{\"City\":[\"Paris\",\"Rome\"],\"Name\":[\"Alice\",\"Bob\"]}}\n",
+		"-json -indent 2": "{\n  \"Sheet1\": {\n    \"City\": [\n      \"Paris\",\n      \"Rome\"\n    ],\n    \"Name\": [\n      \"Alice\",\n      \"Bob\"\n    ]\n  }\n}\n",
+	})
+	if _, _, err := run(t, "", "-json", "-indent", "-1", "-i", pair(t)); err == nil {
+		t.Error("negative -indent was accepted")
+	}
+}
+
+func TestGoStruct(t *testing.T) {
+	book := workbook(t, sheetData{"Stock", [][]any{{"Item name", "Count", "Price", "Sold"}, {"pen", "3", "1.5", "TRUE"}, {"ink", "4", "2", "FALSE"}}})
+	checkOutputs(t, []string{"-i", book}, map[string]string{
+		"-gostruct": "type Stock struct {\n\tItemName string  `json:\"Item name\"`\n\tCount    int     `json:\"Count\"`\n\tPrice    float64 `json:\"Price\"`\n\tSold     bool    `json:\"Sold\"`\n}\n\nvar StockRows = []Stock{\n\t{ItemName: \"pen\", Count: 3, Price: 1.5, Sold: true},\n\t{ItemName: \"ink\", Count: 4, Price: 2, Sold: false},\n}\n",
+	})
+}
+
+// testdata/encrypted.xlsx is excelize's encryptAES.xlsx test workbook, whose password is "password"
+func TestPassword(t *testing.T) {
+	book := filepath.Join("testdata", "encrypted.xlsx")
+	if _, _, err := run(t, "", "-json", "-i", book); err == nil {
+		t.Error("read an encrypted workbook without its password")
+	}
+	want := `{"Sheet1":{"SECRET":[]}}` + "\n"
+	if got := mustRun(t, "", "-json", "-password", "password", "-i", book); got != want {
+		t.Errorf("-password: got %q, want %q", got, want)
+	}
+	t.Setenv("XL_PASSWORD", "password")
+	if got := mustRun(t, "", "-json", "-i", book); got != want {
+		t.Errorf("XL_PASSWORD: got %q, want %q", got, want)
+	}
+}
+
+func TestURL(t *testing.T) {
+	book, err := os.ReadFile(pair(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer x" {
+			http.Error(w, "no", http.StatusForbidden)
+			return
+		}
+		w.Write(book)
+	}))
+	defer srv.Close()
+
+	want := `{"Sheet1":{"City":["Paris","Rome"],"Name":["Alice","Bob"]}}` + "\n"
+	if got := mustRun(t, "", "-json", "-header", "Authorization: Bearer x", "-i", srv.URL+"/book.xlsx"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, _, err := run(t, "", "-json", "-i", srv.URL+"/book.xlsx"); err == nil {
+		t.Error("a 403 response was read as a workbook")
+	}
+}
+
+// Change the workbook at path with fn and save it
+func edit(t *testing.T, path string, fn func(f *xl.File) error) {
+	t.Helper()
+	f, err := xl.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fn(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEval(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"A", "B", "Sum"}, {1, 2}}})
+	edit(t, book, func(f *xl.File) error { return f.SetCellFormula("Sheet1", "C2", "A2+B2") })
+	checkOutputs(t, []string{"-i", book}, map[string]string{
+		"-csv":       "A,B,Sum\n1,2,\n",
+		"-csv -eval": "A,B,Sum\n1,2,3\n",
+	})
+}
+
+// Three single-column sheets, each holding its own name
+func threeSheets(t *testing.T) string {
+	return workbook(t,
+		sheetData{"One", [][]any{{"Sheet"}, {"one"}}},
+		sheetData{"Two", [][]any{{"Sheet"}, {"two"}}},
+		sheetData{"Three", [][]any{{"Sheet"}, {"three"}}},
+	)
+}
+
+func TestSheetIndex(t *testing.T) {
+	book := threeSheets(t)
+	checkOutputs(t, []string{"-i", book}, map[string]string{
+		"-json -sheet-index 1": `{"Two":{"Sheet":["two"]}}` + "\n",
+	})
+	for _, args := range [][]string{{"-sheet-index", "3"}, {"-sheet-index", "0", "-sheet", "One"}} {
+		if _, _, err := run(t, "", append([]string{"-csv", "-i", book}, args...)...); err == nil {
+			t.Errorf("%v was accepted", args)
+		}
+	}
+}
+
+func TestSheets(t *testing.T) {
+	book := threeSheets(t)
+	checkOutputs(t, []string{"-i", book}, map[string]string{
+		"-ndjson -sheets Three,One": "{\"_sheet\":\"Three\",\"Sheet\":\"three\"}\n{\"_sheet\":\"One\",\"Sheet\":\"one\"}\n",
+	})
+	if _, stderr, err := run(t, "", "-json", "-sheets", "One,Nope", "-i", book); err == nil || !strings.Contains(stderr, "Nope") {
+		t.Errorf("missing sheet: got %v: %s", err, stderr)
+	}
+}
+
+func TestList(t *testing.T) {
+	book := workbook(t,
+		sheetData{"Wide", [][]any{{"A", "B", "C"}, {1, 2, 3}}},
+		sheetData{"Tall", [][]any{{"A"}, {1}, {2}, {3}}},
+	)
+	checkOutputs(t, []string{"-i", book}, map[string]string{
+		"-list":       "Wide\t2\t3\nTall\t4\t1\n",
+		"-list -json": "[{\"name\":\"Wide\",\"rows\":2,\"cols\":3},{\"name\":\"Tall\",\"rows\":4,\"cols\":1}]\n",
+	})
+}
+
+func TestTranspose(t *testing.T) {
+	checkOutputs(t, []string{"-i", pair(t)}, map[string]string{
+		"-json -table -transpose": "{\"Sheet1\":[[\"City\",\"Name\"],[\"Paris\",\"Alice\"],[\"Rome\",\"Bob\"]]}\n",
+		"-json -transpose":        "{\"Sheet1\":{\"City\":[\"Name\"],\"Paris\":[\"Alice\"],\"Rome\":[\"Bob\"]}}\n",
+	})
+}
+
+func TestRows(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t)}, map[string]string{
+		"-json -rows 3:4": "{\"People\":{\"Age\":[\"25\",\"41\"],\"City\":[\"Berlin\",\"Rome\"],\"Name\":[\"Bob\",\"Carol\"]}}\n",
+		"-json -rows 4:":  "{\"People\":{\"Age\":[\"41\"],\"City\":[\"Rome\"],\"Name\":[\"Carol\"]}}\n",
+	})
+	for _, rows := range []string{"x:2", "1:0", "2:-1"} {
+		if _, _, err := run(t, "", "-json", "-rows", rows, "-i", people(t)); err == nil {
+			t.Errorf("-rows %s was accepted", rows)
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t)}, map[string]string{
+		"-json -table -columns City,Name": "{\"People\":[[\"City\",\"Paris\",\"Berlin\",\"Rome\"],[\"Name\",\"Alice\",\"Bob\",\"Carol\"]]}\n",
+	})
+	if _, stderr, err := run(t, "", "-json", "-columns", "Name,Nope", "-i", people(t)); err == nil || !strings.Contains(stderr, "Nope") {
+		t.Errorf("missing column: got %v: %s", err, stderr)
+	}
+}
+
+func TestHeadTail(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t)}, map[string]string{
+		"-json -table -head 1": "{\"People\":[[\"Name\",\"Alice\"],[\"Age\",\"30\"],[\"City\",\"Paris\"]]}\n",
+		"-json -table -tail 2": "{\"People\":[[\"Name\",\"Bob\",\"Carol\"],[\"Age\",\"25\",\"41\"],[\"City\",\"Berlin\",\"Rome\"]]}\n",
+	})
+	if _, _, err := run(t, "", "-json", "-head", "1", "-tail", "1", "-i", people(t)); err == nil {
+		t.Error("-head with -tail was accepted")
+	}
+}
+
+// A sheet with a blank row and a column that's empty but for its title
+func gappy(t *testing.T) string {
+	return workbook(t, sheetData{"Sheet1", [][]any{{"A", "Empty", "B"}, {"1", "", "x"}, {" ", "", ""}, {"2", "", "y"}}})
+}
+
+func TestDropEmptyRows(t *testing.T) {
+	checkOutputs(t, []string{"-i", gappy(t)}, map[string]string{
+		"-json -table -drop-empty-rows": "{\"Sheet1\":[[\"A\",\"1\",\"2\"],[\"Empty\",\"\",\"\"],[\"B\",\"x\",\"y\"]]}\n",
+	})
+}
+
+func TestDropEmptyCols(t *testing.T) {
+	in := workbook(t, sheetData{"Sheet1", [][]any{{"A", "Empty", "", "B"}, {"1", "", "", "x"}, {"2", " ", "", "y"}}})
+	checkOutputs(t, []string{"-i", in, "-csv"}, map[string]string{
+		"-drop-empty-cols":   "A,Empty,B\n1,,x\n2,\" \",y\n",
+		"-drop-titled-empty": "A,B\n1,x\n2,y\n",
+	})
+}
+
+func TestWhere(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t), "-csv"}, map[string]string{
+		"-where Name=Bob":                 "Name,Age,City\nBob,25,Berlin\n",
+		"-where Name!=Bob":                "Name,Age,City\nAlice,30,Paris\nCarol,41,Rome\n",
+		"-where Name~^[AC] -where Age=30": "Name,Age,City\nAlice,30,Paris\n",
+	})
+	if _, _, err := run(t, "", "-i", people(t), "-csv", "-where", "Nope=1"); err == nil {
+		t.Error("-where on an unknown column should fail")
+	}
+}
+
+func TestColumnStats(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t), "-stats"}, map[string]string{
+		"-json": "{\"People\":{\"columns\":[{\"name\":\"Name\",\"index\":0,\"rows\":3,\"count\":3,\"numeric\":0,\"distinct\":3,\"missing\":0,\"types\":{\"string\":3},\"type\":\"string\",\"mismatch\":0},{\"name\":\"Age\",\"index\":1,\"rows\":3,\"count\":3,\"numeric\":3,\"min\":25,\"max\":41,\"mean\":32,\"distinct\":3,\"missing\":0,\"types\":{\"int\":3},\"type\":\"int\",\"mismatch\":0},{\"name\":\"City\",\"index\":2,\"rows\":3,\"count\":3,\"numeric\":0,\"distinct\":3,\"missing\":0,\"types\":{\"string\":3},\"type\":\"string\",\"mismatch\":0}],\"rowCount\":3,\"colCount\":3}}\n",
+	})
+	if out := mustRun(t, "", "-i", people(t), "-stats"); !strings.Contains(out, `Column stats: "Age" count: 3 numeric: 3 min: 25 max: 41 mean: 32`) {
+		t.Errorf("missing Age stats in:\n%s", out)
+	}
+}
+
+func TestColumnTypes(t *testing.T) {
+	in := workbook(t, sheetData{"Sheet1", [][]any{{"When", "Mixed"}, {"2021-03-04", "1"}, {"2022-01-02", "x"}, {"", "2"}}})
+	checkOutputs(t, []string{"-i", in, "-stats"}, map[string]string{
+		"-json": "{\"Sheet1\":{\"columns\":[{\"name\":\"When\",\"index\":0,\"rows\":3,\"count\":2,\"numeric\":0,\"distinct\":2,\"missing\":1,\"types\":{\"date\":2},\"type\":\"date\",\"mismatch\":0},{\"name\":\"Mixed\",\"index\":1,\"rows\":3,\"count\":3,\"numeric\":2,\"min\":1,\"max\":2,\"mean\":1.5,\"distinct\":3,\"missing\":0,\"types\":{\"int\":2,\"string\":1},\"type\":\"int\",\"mismatch\":1}],\"rowCount\":3,\"colCount\":2}}\n",
+	})
+}
+
+func TestCSVSheets(t *testing.T) {
+	checkOutputs(t, []string{"-i", threeSheets(t), "-csv"}, map[string]string{
+		"-sheet Two": "Sheet\ntwo\n",
+		"-all":       "Sheet\none\n\nSheet\ntwo\n\nSheet\nthree\n",
+	})
+}
+
+func TestSheetTotals(t *testing.T) {
+	in := workbook(t,
+		sheetData{"Wide", [][]any{{"A", "B", "C"}, {"1", "2", "3"}}},
+		sheetData{"Narrow", [][]any{{"A"}, {"1"}}},
+	)
+	_, stderr, err := run(t, "", "-i", in, "-all", "-csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`sheet: "Wide" #cols: 3 #elements: 6`, `sheet: "Narrow" #cols: 1 #elements: 2`} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("missing %q in:\n%s", want, stderr)
+		}
+	}
+}
+
+func TestDuplicateTitles(t *testing.T) {
+	in := workbook(t, sheetData{"Sheet1", [][]any{{"A", "B", "A", "A"}, {"1", "2", "3", "4"}}})
+	checkOutputs(t, []string{"-i", in, "-json"}, map[string]string{
+		"":           "{\"Sheet1\":{\"A\":[\"1\"],\"A_2\":[\"3\"],\"A_3\":[\"4\"],\"B\":[\"2\"]}}\n",
+		"-dup-merge": "{\"Sheet1\":{\"A\":[\"1\",\"3\",\"4\"],\"B\":[\"2\"]}}\n",
+	})
+}
+
+func TestGofmt(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t), "-go"}, map[string]string{
+		"":       "map[string]map[string][]string{\"People\":map[string][]string{\"Age\":[]string{\"30\", \"25\", \"41\"}, \"City\":[]string{\"Paris\", \"Berlin\", \"Rome\"}, \"Name\":[]string{\"Alice\", \"Bob\", \"Carol\"}}}\n",
+		"-gofmt": "map[string]map[string][]string{\n\t\"People\": {\n\t\t\"Age\":  {\"30\", \"25\", \"41\"},\n\t\t\"City\": {\"Paris\", \"Berlin\", \"Rome\"},\n\t\t\"Name\": {\"Alice\", \"Bob\", \"Carol\"},\n\t},\n}\n",
+	})
+}
+
+func TestXLSX(t *testing.T) {
+	if _, _, err := run(t, "", "-i", people(t), "-xlsx"); err == nil {
+		t.Error("-xlsx without -o should fail")
+	}
+	out := filepath.Join(t.TempDir(), "out.xlsx")
+	mustRun(t, "", "-i", threeSheets(t), "-all", "-xlsx", "-o", out)
+	want := "Sheet\none\n\nSheet\ntwo\n\nSheet\nthree\n"
+	if got := mustRun(t, "", "-i", out, "-all", "-csv"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRaw(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Price"}, {1000}}})
+	edit(t, book, func(f *xl.File) error {
+		style, err := f.NewStyle(&xl.Style{NumFmt: 4})
+		if err != nil {
+			return err
+		}
+		return f.SetCellStyle("Sheet1", "A2", "A2", style)
+	})
+	checkOutputs(t, []string{"-i", book, "-csv"}, map[string]string{
+		"":     "Price\n1000.00\n",
+		"-raw": "Price\n1000\n",
+	})
+}
+
+func TestDates(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"When"}, {time.Date(2021, 3, 4, 5, 6, 0, 0, time.UTC)}}})
+	checkOutputs(t, []string{"-i", book, "-csv"}, map[string]string{
+		"-dates":                  "When\n2021-03-04\n",
+		"-datetime":               "When\n2021-03-04T05:06:00Z\n",
+		"-date-format 02/01/2006": "When\n04/03/2021\n",
+	})
+}
+
+func TestLegacyXLS(t *testing.T) {
+	// An OLE compound file without an EncryptionInfo stream
+	path := filepath.Join(t.TempDir(), "old.xls")
+	ole := append([]byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, make([]byte, 504)...)
+	if err := os.WriteFile(path, ole, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, stderr, err := run(t, "", "-i", path, "-csv")
+	if err == nil || !strings.Contains(stderr, "legacy .xls") {
+		t.Errorf("want a legacy .xls error, got %v: %s", err, stderr)
+	}
+}
+
+func TestFromCSV(t *testing.T) {
+	out := mustRun(t, "Name,Age\nAlice,30\nBob,25\n", "-from-csv", "-json")
+	if want := `{"Sheet1":{"Age":["30","25"],"Name":["Alice","Bob"]}}` + "\n"; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func TestDelimiter(t *testing.T) {
+	out := mustRun(t, "Name;Age\nAlice;30\n", "-from-csv", "-delimiter", ";", "-json")
+	if want := `{"Sheet1":{"Age":["30"],"Name":["Alice"]}}` + "\n"; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+	out = mustRun(t, "", "-i", people(t), "-csv", "-delimiter", ";", "-head", "1")
+	if want := "Name;Age;City\nAlice;30;Paris\n"; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+	if _, _, err := run(t, "", "-i", people(t), "-csv", "-delimiter", "ab"); err == nil {
+		t.Error("a multi-character -delimiter should fail")
+	}
+}
+
+func TestBOM(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t), "-head", "1", "-bom"}, map[string]string{
+		"-csv": "\xEF\xBB\xBFName,Age,City\nAlice,30,Paris\n",
+		"-tsv": "\xEF\xBB\xBFName\tAge\tCity\nAlice\t30\tParis\n",
+	})
+}
+
+func TestHyperlinks(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Site"}, {"home"}, {"none"}}})
+	edit(t, book, func(f *xl.File) error { return f.SetCellHyperLink("Sheet1", "A2", "https://example.com", "External") })
+	checkOutputs(t, []string{"-i", book, "-hyperlinks"}, map[string]string{
+		"-json": "{\"Sheet1\":{\"Site\":[{\"text\":\"home\",\"link\":\"https://example.com\"},\"none\"]}}\n",
+		"-csv":  "Site\nhome (https://example.com)\nnone\n",
+	})
+}
+
+func TestHyperlinksFilter(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Site", "Note"}, {"home", "x"}, {"home (https://example.com)", "y"}, {"none", "z"}}})
+	edit(t, book, func(f *xl.File) error { return f.SetCellHyperLink("Sheet1", "A2", "https://example.com", "External") })
+	checkOutputs(t, []string{"-i", book, "-hyperlinks"}, map[string]string{
+		"-csv -where Site=home":                "Site,Note\nhome (https://example.com),x\n",
+		"-csv -grep example":                   "Site,Note\nhome (https://example.com),y\n",
+		"-csv -sort Site":                      "Site,Note\nhome (https://example.com),x\nhome (https://example.com),y\nnone,z\n",
+		"-csv -where Site=home -group-by Site": "Site,count\nhome (https://example.com),1\n",
+		"-json -sort Site:desc":                "{\"Sheet1\":{\"Note\":[\"z\",\"y\",\"x\"],\"Site\":[\"none\",\"home (https://example.com)\",{\"text\":\"home\",\"link\":\"https://example.com\"}]}}\n",
+		"-records -columns Note,Site":          "[{\"Note\":\"x\",\"Site\":{\"text\":\"home\",\"link\":\"https://example.com\"}},{\"Note\":\"y\",\"Site\":\"home (https://example.com)\"},{\"Note\":\"z\",\"Site\":\"none\"}]\n",
+	})
+}
+
+func TestComments(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Name"}, {"Alice"}, {"Bob"}}})
+	edit(t, book, func(f *xl.File) error { return f.AddComment("Sheet1", "A3", `{"author":"","text":"note"}`) })
+	checkOutputs(t, []string{"-i", book, "-comments"}, map[string]string{
+		"-json":                "{\"Sheet1\":{\"Name\":[\"Alice\",\"Bob\"]},\"_comments\":{\"Sheet1\":{\"A3\":\"note\"}}}\n",
+		"-csv":                 "Name\nAlice\nBob (note)\n",
+		"-json -cast Name:int": "{\"Sheet1\":{\"Name\":[null,null]},\"_comments\":{\"Sheet1\":{\"A3\":\"note\"}}}\n",
+	})
+}
+
+func TestUnmerge(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"A", "B"}, {"x", ""}, {"", "y"}}})
+	edit(t, book, func(f *xl.File) error { return f.MergeCell("Sheet1", "A2", "A3") })
+	checkOutputs(t, []string{"-i", book, "-csv"}, map[string]string{
+		"":         "A,B\nx,\n,y\n",
+		"-unmerge": "A,B\nx,\nx,y\n",
+	})
+}
+
+func TestTrim(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{" Name "}, {"  Alice\t"}}})
+	checkOutputs(t, []string{"-i", book, "-json"}, map[string]string{
+		"":      "{\"Sheet1\":{\" Name \":[\"  Alice\\t\"]}}\n",
+		"-trim": "{\"Sheet1\":{\"Name\":[\"Alice\"]}}\n",
+	})
+}
+
+func TestSnake(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Item Name", "UnitPrice", "item--name!"}, {"pen", "1.5", "x"}}})
+	checkOutputs(t, []string{"-i", book, "-json", "-snake"}, map[string]string{
+		"":               "{\"Sheet1\":{\"item_name\":[\"pen\"],\"item_name_2\":[\"x\"],\"unitprice\":[\"1.5\"]}}\n",
+		"-keep-original": "{\"Sheet1\":{\"item_name\":[\"pen\"],\"item_name_2\":[\"x\"],\"unitprice\":[\"1.5\"]},\"_titles\":{\"Sheet1\":{\"item_name\":\"Item Name\",\"item_name_2\":\"item--name!\",\"unitprice\":\"UnitPrice\"}}}\n",
+	})
+}
+
+func TestGoPackage(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Name"}, {"Alice"}}})
+	checkOutputs(t, []string{"-i", book, "-go-package", "data"}, map[string]string{
+		"-go":                "package data\n\nvar Book = map[string]map[string][]string{\"Sheet1\":map[string][]string{\"Name\":[]string{\"Alice\"}}}\n",
+		"-go -go-var People": "package data\n\nvar People = map[string]map[string][]string{\"Sheet1\":map[string][]string{\"Name\":[]string{\"Alice\"}}}\n",
+		"-gostruct":          "package data\n\ntype Sheet1 struct {\n\tName string `json:\"Name\"`\n}\n\nvar Sheet1Rows = []Sheet1{\n\t{Name: \"Alice\"},\n}\n",
+	})
+}
+
+func TestSheetMatch(t *testing.T) {
+	checkOutputs(t, []string{"-i", threeSheets(t), "-csv"}, map[string]string{
+		"-sheet-match ^T": "Sheet\ntwo\n\nSheet\nthree\n",
+	})
+	if _, _, err := run(t, "", "-i", threeSheets(t), "-csv", "-sheet-match", "^T", "-sheet", "Two"); err == nil {
+		t.Error("-sheet-match with -sheet should fail")
+	}
+}
+
+func TestSort(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t), "-csv"}, map[string]string{
+		"-sort Age":       "Name,Age,City\nBob,25,Berlin\nAlice,30,Paris\nCarol,41,Rome\n",
+		"-sort City:desc": "Name,Age,City\nCarol,41,Rome\nAlice,30,Paris\nBob,25,Berlin\n",
+	})
+	nums := workbook(t, sheetData{"Sheet1", [][]any{{"N"}, {"10"}, {"9"}, {"100"}}})
+	if got, want := mustRun(t, "", "-i", nums, "-csv", "-sort", "N"), "N\n9\n10\n100\n"; got != want {
+		t.Errorf("numeric -sort: got %q, want %q", got, want)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"K", "V"}, {"a", "1"}, {"a", "1"}, {"a", "2"}, {"b", "1"}}})
+	checkOutputs(t, []string{"-i", book, "-csv"}, map[string]string{
+		"-dedup":      "K,V\na,1\na,2\nb,1\n",
+		"-dedup-on K": "K,V\na,1\nb,1\n",
+	})
+}
+
+func TestGroupBy(t *testing.T) {
+	book := workbook(t, sheetData{"Sales", [][]any{{"Region", "Amount"}, {"east", 10}, {"west", 5}, {"east", 4}}})
+	checkOutputs(t, []string{"-i", book, "-csv", "-group-by", "Region"}, map[string]string{
+		"-agg Amount:sum -agg Amount:count": "Region,Amount_sum,Amount_count\neast,14,2\nwest,5,1\n",
+		"-agg Amount:avg -agg Amount:max":   "Region,Amount_avg,Amount_max\neast,7,10\nwest,5,5\n",
+	})
+}
+
+func TestJoinSheets(t *testing.T) {
+	book := workbook(t,
+		sheetData{"People", [][]any{{"ID", "Name"}, {"1", "Alice"}, {"2", "Bob"}}},
+		sheetData{"Ages", [][]any{{"ID", "Age"}, {"1", "30"}}},
+	)
+	checkOutputs(t, []string{"-i", book, "-csv", "-join-sheets", "People,Ages", "-join-on", "ID"}, map[string]string{
+		"":                "ID,Name,Age\n1,Alice,30\n",
+		"-join-type left": "ID,Name,Age\n1,Alice,30\n2,Bob,\n",
+	})
+}
+
+func TestFillDown(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Group", "Item"}, {"fruit", "apple"}, {"", "pear"}, {"veg", "leek"}, {"", "kale"}}})
+	checkOutputs(t, []string{"-i", book, "-csv"}, map[string]string{
+		"-fill-down Group": "Group,Item\nfruit,apple\nfruit,pear\nveg,leek\nveg,kale\n",
+	})
+}
+
+func TestCount(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t), "-count"}, map[string]string{
+		"":      "3 3\n",
+		"-json": "{\"People\":{\"rows\":3,\"cols\":3}}\n",
+	})
+}
+
+func TestQuiet(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"A", "A"}, {"1", "2"}}})
+	for _, tc := range []struct {
+		flag string
+		want []string
+	}{
+		{"", []string{"warn: duplicate column title"}},
+		{"-quiet", nil},
+		{"-verbose", []string{"warn: duplicate column title", "cells"}},
+	} {
+		args := []string{"-i", book, "-json"}
+		if tc.flag != "" {
+			args = append(args, tc.flag)
+		}
+		_, stderr, err := run(t, "", args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.want == nil && stderr != "" {
+			t.Errorf("%s: unexpected stderr %q", tc.flag, stderr)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(stderr, want) {
+				t.Errorf("%s: missing %q in stderr %q", tc.flag, want, stderr)
+			}
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	out := mustRun(t, "", "-version")
+	if !strings.HasPrefix(out, "xl ") || !strings.Contains(out, "excelize") {
+		t.Errorf("unexpected -version output %q", out)
+	}
+}
+
+func TestMultipleInputs(t *testing.T) {
+	a := workbook(t, sheetData{"Sheet1", [][]any{{"Name"}, {"Alice"}}})
+	b := workbook(t, sheetData{"Sheet1", [][]any{{"Name"}, {"Bob"}}})
+	checkOutputs(t, []string{"-csv"}, map[string]string{
+		"-i " + a + " " + b: "Name\nAlice\nBob\n",
+	})
+	out := mustRun(t, "", "-csv", "-source-col", "From", "-i", a, b)
+	if want := "Name,From\nAlice," + a + "\nBob," + b + "\n"; out != want {
+		t.Errorf("-source-col: got %q, want %q", out, want)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tmpl := filepath.Join(t.TempDir(), "t.tmpl")
+	text := `{{range $sheet, $rows := .Sheets}}{{range $rows}}{{.Name}} is {{.Age}}; {{end}}{{end}}`
+	if err := os.WriteFile(tmpl, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := mustRun(t, "", "-i", people(t), "-template", tmpl), "Alice is 30; Bob is 25; Carol is 41; "; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestErrorCells(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"A", "B"}, {"1", "#DIV/0!"}, {"#REF!", "2"}}})
+	if out := mustRun(t, "", "-i", book, "-stats"); !strings.Contains(out, "Error cells: 2 at A3, B2") {
+		t.Errorf("missing error cells in:\n%s", out)
+	}
+	stdout, stderr, err := run(t, "", "-i", book, "-csv", "-fail-on-errors")
+	if err == nil || stdout != "" || !strings.Contains(stderr, "Sheet1!A3, Sheet1!B2") {
+		t.Errorf("-fail-on-errors: err %v, stdout %q, stderr %q", err, stdout, stderr)
+	}
+}
+
+func TestXML(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Name", "Note"}, {"Alice", "a<b"}}})
+	checkOutputs(t, []string{"-i", book, "-xml"}, map[string]string{
+		"":       "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<book><sheet name=\"Sheet1\"><row><cell name=\"Name\">Alice</cell><cell name=\"Note\">a&lt;b</cell></row></sheet></book>\n",
+		"-table": "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<book><sheet name=\"Sheet1\"><row><cell>Name</cell><cell>Note</cell></row><row><cell>Alice</cell><cell>a&lt;b</cell></row></sheet></book>\n",
+	})
+}
+
+func TestStream(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t), "-stream"}, map[string]string{
+		"-csv":    "Name,Age,City\nAlice,30,Paris\nBob,25,Berlin\nCarol,41,Rome\n",
+		"-ndjson": "{\"Name\":\"Alice\",\"Age\":\"30\",\"City\":\"Paris\"}\n{\"Name\":\"Bob\",\"Age\":\"25\",\"City\":\"Berlin\"}\n{\"Name\":\"Carol\",\"Age\":\"41\",\"City\":\"Rome\"}\n",
+	})
+	if _, _, err := run(t, "", "-i", people(t), "-stream", "-csv", "-sort", "Age"); err == nil {
+		t.Error("-stream with -sort should fail")
+	}
+	if _, _, err := run(t, "", "-i", people(t), "-stream", "-json"); err == nil {
+		t.Error("-stream with -json should fail")
+	}
+	if _, _, err := run(t, "", "-i", people(t), "-stream", "-csv", "-fail-on-errors"); err == nil {
+		t.Error("-stream with -fail-on-errors should fail")
+	}
+	if _, _, err := run(t, "", "-i", people(t), "-stream", "-csv", "-split", "-o", t.TempDir()); err == nil {
+		t.Error("-stream with -split should fail")
+	}
+	if _, _, err := run(t, "", "-i", people(t), "-stream", "-csv", "-bool-as", "10"); err == nil {
+		t.Error("-stream with -bool-as should fail")
+	}
+	if _, _, err := run(t, "", "-i", people(t), "-stream", "-csv", "-null-as", "NA"); err == nil {
+		t.Error("-stream with -null-as should fail")
+	}
+	if _, _, err := run(t, "", "-i", people(t), "-stream", "-csv", "-rename-cols", "Name=Who"); err == nil {
+		t.Error("-stream with -rename-cols should fail")
+	}
+	// Of many conflicting flags, the same one is reported every run
+	for i := 0; i < 5; i++ {
+		_, stderr, _ := run(t, "", "-i", people(t), "-stream", "-csv", "-transpose", "-tail", "1", "-sort", "Age")
+		if want := "-sort can't be used with -stream\n"; stderr != want {
+			t.Fatalf("-stream with many conflicts: got %q, want %q", stderr, want)
+		}
+	}
+}
+
+func TestJobs(t *testing.T) {
+	var sheets []sheetData
+	for i := 1; i <= 8; i++ {
+		sheets = append(sheets, sheetData{"S" + strconv.Itoa(i), [][]any{{"N"}, {i}}})
+	}
+	book := workbook(t, sheets...)
+	want := mustRun(t, "", "-i", book, "-all", "-csv")
+	if got := mustRun(t, "", "-i", book, "-all", "-csv", "-jobs", "4"); got != want {
+		t.Errorf("-jobs 4: got %q, want %q", got, want)
+	}
+}
+
+func TestRange(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"title"}, {"", "A", "B", "C"}, {"", "1", "2", "3"}, {"", "4", "5", "6"}}})
+	checkOutputs(t, []string{"-i", book, "-csv"}, map[string]string{
+		"-range B2:C3": "A,B\n1,2\n",
+		"-range C3:Z9": "2,3\n5,6\n",
+	})
+}
+
+func TestJSONSchema(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t)}, map[string]string{
+		"-jsonschema": "{\"$schema\":\"http://json-schema.org/draft-07/schema#\",\"items\":{\"properties\":{\"Age\":{\"type\":\"integer\"},\"City\":{\"type\":\"string\"},\"Name\":{\"type\":\"string\"}},\"required\":[\"Name\",\"Age\",\"City\"],\"type\":\"object\"},\"title\":\"People\",\"type\":\"array\"}\n",
+	})
+}
+
+func TestSkipRows(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Quarterly report"}, {}, {"Name", "Age"}, {"Alice", "30"}}})
+	checkOutputs(t, []string{"-i", book, "-csv"}, map[string]string{
+		"-skip-rows 2": "Name,Age\nAlice,30\n",
+	})
+}
+
+func TestRangeMisses(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"A"}, {"1"}}})
+	stdout, stderr, err := run(t, "", "-i", book, "-csv", "-range", "D5:E6")
+	if err != nil || stdout != "" || !strings.Contains(stderr, "warn:") {
+		t.Errorf("err %v, stdout %q, stderr %q", err, stdout, stderr)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	dir := t.TempDir()
+	mustRun(t, "", "-i", threeSheets(t), "-all", "-csv", "-split", "-o", filepath.Join(dir, "{sheet}.csv"))
+	for _, sheet := range []string{"One", "Two", "Three"} {
+		got, err := os.ReadFile(filepath.Join(dir, sheet+".csv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "Sheet\n" + strings.ToLower(sheet) + "\n"; string(got) != want {
+			t.Errorf("%s: got %q, want %q", sheet, got, want)
+		}
+	}
+
+	// A directory -o is only created when the files are written
+	sub := filepath.Join(dir, "sub")
+	mustRun(t, "", "-i", threeSheets(t), "-all", "-csv", "-split", "-o", sub, "-dry-run")
+	if _, err := os.Stat(sub); !os.IsNotExist(err) {
+		t.Errorf("-dry-run created %s", sub)
+	}
+	mustRun(t, "", "-i", threeSheets(t), "-all", "-csv", "-split", "-o", sub)
+	if got, err := os.ReadFile(filepath.Join(sub, "Two.csv")); err != nil || string(got) != "Sheet\ntwo\n" {
+		t.Errorf("directory -o: got %q, %v", got, err)
+	}
+}
+
+func TestTextColumns(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Zip", "N"}, {"01234", "7"}}})
+	checkOutputs(t, []string{"-i", book, "-gostruct"}, map[string]string{
+		"":                  "type Sheet1 struct {\n\tZip int `json:\"Zip\"`\n\tN   int `json:\"N\"`\n}\n\nvar Sheet1Rows = []Sheet1{\n\t{Zip: 1234, N: 7},\n}\n",
+		"-text-columns Zip": "type Sheet1 struct {\n\tZip string `json:\"Zip\"`\n\tN   int    `json:\"N\"`\n}\n\nvar Sheet1Rows = []Sheet1{\n\t{Zip: \"01234\", N: 7},\n}\n",
+	})
+}
+
+func TestBoolAs(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Done", "Name"}, {"yes", "a"}, {"no", "b"}}})
+	checkOutputs(t, []string{"-i", book}, map[string]string{
+		"-csv -bool-as 10":    "Done,Name\n1,a\n0,b\n",
+		"-json -bool-as json": "{\"Sheet1\":{\"Done\":[true,false],\"Name\":[\"a\",\"b\"]}}\n",
+	})
+}
+
+func TestNullAs(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"A", "B"}, {"1", ""}}})
+	checkOutputs(t, []string{"-i", book}, map[string]string{
+		"-json -null-as null": "{\"Sheet1\":{\"A\":[\"1\"],\"B\":[null]}}\n",
+		"-csv -null-as NA":    "A,B\n1,NA\n",
+	})
+}
+
+func TestExitCodes(t *testing.T) {
+	garbage := filepath.Join(t.TempDir(), "garbage.xlsx")
+	if err := os.WriteFile(garbage, []byte("not a workbook"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"-i", filepath.Join(t.TempDir(), "missing.xlsx")}, 2},
+		{[]string{"-i", people(t), "-sheet", "Nope"}, 3},
+		{[]string{"-i", people(t), "-sheet", "Nope", "-count"}, 3},
+		{[]string{"-i", garbage}, 4},
+		{[]string{"-i", filepath.Join("testdata", "encrypted.xlsx")}, 5},
+		{[]string{"-i", filepath.Join("testdata", "encrypted.xlsx"), "-password", "wrong"}, 5},
+	} {
+		_, _, err := run(t, "", append(tc.args, "-json")...)
+		if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != tc.code {
+			t.Errorf("%v: got %v, want exit status %d", tc.args, err, tc.code)
+		}
+	}
+}
+
+// Cells of ragged rows must stay in their sheet row, whatever the widths of the rows around them
+func TestRaggedRows(t *testing.T) {
+	rows := [][]any{{"A", "B", "C"}, {"1"}, {"2", "3", "4", "5"}, {"6", "", ""}}
+	book := workbook(t, sheetData{"Sheet1", rows})
+	csvIn := filepath.Join(t.TempDir(), "ragged.csv")
+	if err := os.WriteFile(csvIn, []byte("A,B,C\n1\n2,3,4,5\n6,,\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"csv", []string{"-csv"}, "A,B,C,\n1,,,\n2,3,4,5\n6,,,\n"},
+		{"tsv", []string{"-tsv"}, "A\tB\tC\t\n1\t\t\t\n2\t3\t4\t5\n6\t\t\t\n"},
+		{"matrix json", []string{"-json", "-table"}, `{"Sheet1":[["A","1","2","6"],["B","","3",""],["C","","4",""],["","","5"]]}` + "\n"},
+		{"filtered", []string{"-csv", "-where", "A=2"}, "A,B,C,\n2,3,4,5\n"},
+		{"row range", []string{"-csv", "-rows", "3:4"}, "A,B,C,\n2,3,4,5\n6,,,\n"},
+	}
+	for _, in := range []struct {
+		name string
+		args []string
+	}{{"xlsx", []string{book}}, {"from-csv", []string{"-from-csv", csvIn}}} {
+		for _, tt := range tests {
+			args := append(append([]string{"-quiet"}, tt.args...), in.args...)
+			if got := mustRun(t, "", args...); got != tt.want {
+				t.Errorf("%s %s: got %q, want %q", in.name, tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+// Write an OpenDocument spreadsheet whose content.xml body is tables, returning its path
+func ods(t *testing.T, tables string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "book.ods")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	// The mimetype comes first and uncompressed, so readers can sniff it
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "application/vnd.oasis.opendocument.spreadsheet")
+	if w, err = zw.Create("content.xml"); err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0">
+<office:body><office:spreadsheet>`+tables+`</office:spreadsheet></office:body></office:document-content>`)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestODS(t *testing.T) {
+	book := ods(t, `<table:table table:name="Plan">
+<table:table-row><table:table-cell><text:p>Name</text:p></table:table-cell><table:table-cell table:number-columns-repeated="2"/><table:table-cell><text:p>Note</text:p></table:table-cell></table:table-row>
+<table:table-row><table:table-cell><text:p>a<text:s text:c="2"/>b</text:p><office:annotation><text:p>hidden</text:p></office:annotation></table:table-cell><table:table-cell table:number-columns-repeated="3"><text:p>x</text:p></table:table-cell></table:table-row>
+<table:table-row table:number-rows-repeated="1000"><table:table-cell table:number-columns-repeated="1024"/></table:table-row>
+</table:table>`)
+	checkOutputs(t, []string{"-i", book}, map[string]string{
+		"-csv": "Name,,,Note\na  b,x,x,x\n",
+	})
+}
+
+func TestRenameCols(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t), "-head", "1"}, map[string]string{
+		"-csv -rename-cols Name=Who,City=Where":           "Who,Age,Where\nAlice,30,Paris\n",
+		"-json -columns City,Name -rename-cols City=Town": "{\"People\":{\"Name\":[\"Alice\"],\"Town\":[\"Paris\"]}}\n",
+	})
+	stdout, stderr, err := run(t, "", "-i", people(t), "-csv", "-head", "1", "-rename-cols", "Nope=X")
+	if err != nil || stdout != "Name,Age,City\nAlice,30,Paris\n" || !strings.Contains(stderr, "warn:") {
+		t.Errorf("renaming an unknown column should only warn: err %v, stdout %q, stderr %q", err, stdout, stderr)
+	}
+}
+
+func TestPretty(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Name", "Note"}, {"Alice", "a rather long note"}}})
+	checkOutputs(t, []string{"-i", book, "-pretty"}, map[string]string{
+		"":             "┌───────┬────────────────────┐\n│ Name  │ Note               │\n├───────┼────────────────────┤\n│ Alice │ a rather long note │\n└───────┴────────────────────┘\n",
+		"-max-width 6": "┌───────┬────────┐\n│ Name  │ Note   │\n├───────┼────────┤\n│ Alice │ a rat… │\n└───────┴────────┘\n",
+	})
+}
+
+func TestSample(t *testing.T) {
+	var rows [][]any
+	rows = append(rows, []any{"N"})
+	for i := 1; i <= 20; i++ {
+		rows = append(rows, []any{i})
+	}
+	book := workbook(t, sheetData{"Sheet1", rows})
+	first := mustRun(t, "", "-i", book, "-csv", "-sample", "5", "-seed", "7")
+	if again := mustRun(t, "", "-i", book, "-csv", "-sample", "5", "-seed", "7"); again != first {
+		t.Errorf("-seed didn't repeat the sample: %q then %q", first, again)
+	}
+	lines := strings.Split(strings.TrimSpace(first), "\n")
+	if len(lines) != 6 || lines[0] != "N" {
+		t.Fatalf("want a title and 5 rows, got %q", first)
+	}
+	prev := 0
+	for _, line := range lines[1:] {
+		n, err := strconv.Atoi(line)
+		if err != nil || n <= prev {
+			t.Errorf("rows out of their original order: %q", first)
+		}
+		prev = n
+	}
+}
+
+func TestActiveSheet(t *testing.T) {
+	book := threeSheets(t)
+	edit(t, book, func(f *xl.File) error {
+		f.SetActiveSheet(f.GetSheetIndex("Two"))
+		return nil
+	})
+	checkOutputs(t, []string{"-i", book, "-csv"}, map[string]string{
+		"":       "Sheet\ntwo\n",
+		"-first": "Sheet\none\n",
+	})
+}
+
+func TestStyles(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Name"}, {"Alice"}}})
+	edit(t, book, func(f *xl.File) error {
+		style, err := f.NewStyle(&xl.Style{Font: &xl.Font{Bold: true}, Fill: xl.Fill{Type: "pattern", Pattern: 1, Color: []string{"FFFF00"}}})
+		if err != nil {
+			return err
+		}
+		return f.SetCellStyle("Sheet1", "A2", "A2", style)
+	})
+	checkOutputs(t, []string{"-i", book, "-styles"}, map[string]string{
+		"-json": "{\"Sheet1\":{\"Name\":[\"Alice\"]},\"_styles\":{\"Sheet1\":{\"A2\":{\"fill\":\"FFFFFF00\",\"bold\":true}}}}\n",
+	})
+	if _, _, err := run(t, "", "-i", book, "-styles", "-csv"); err == nil {
+		t.Error("-styles without -json should fail")
+	}
+}
+
+func TestMaxCellLength(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Description"}, {"short"}, {"much too long"}}})
+	checkOutputs(t, []string{"-i", book, "-csv", "-max-cell-length", "6"}, map[string]string{
+		"":                     "Descri…\nshort\nmuch t…\n",
+		"-truncate-marker ...": "Descri...\nshort\nmuch t...\n",
+	})
+}
+
+func TestGrep(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t), "-csv"}, map[string]string{
+		"-grep ^B":     "Name,Age,City\nBob,25,Berlin\n",
+		"-grep-v Rome": "Name,Age,City\nAlice,30,Paris\nBob,25,Berlin\n",
+	})
+}
+
+func TestColRange(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t), "-csv"}, map[string]string{
+		"-col-range B:C": "Age,City\n30,Paris\n25,Berlin\n41,Rome\n",
+		"-col-range C:":  "City\nParis\nBerlin\nRome\n",
+	})
+}
+
+func TestEncoding(t *testing.T) {
+	// "Café" in windows-1252
+	out := mustRun(t, "Name\nCaf\xe9\n", "-from-csv", "-encoding", "windows-1252", "-json")
+	if want := `{"Sheet1":{"Name":["Café"]}}` + "\n"; out != want {
+		t.Errorf("input: got %q, want %q", out, want)
+	}
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Name"}, {"Café"}}})
+	out = mustRun(t, "", "-i", book, "-encoding", "latin1", "-csv")
+	if want := "Name\nCaf\xe9\n"; out != want {
+		t.Errorf("output: got %q, want %q", out, want)
+	}
+}
+
+func TestAlphaKeys(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"1", "x"}, {"2", "y"}}})
+	checkOutputs(t, []string{"-i", book, "-alpha-keys"}, map[string]string{
+		"-json": "{\"Sheet1\":{\"A\":[\"1\",\"2\"],\"B\":[\"x\",\"y\"]}}\n",
+		"-csv":  "A,B\n1,x\n2,y\n",
+	})
+}
+
+func TestFlatten(t *testing.T) {
+	book := workbook(t,
+		sheetData{"Jan", [][]any{{"Item", "Qty"}, {"pen", "1"}}},
+		sheetData{"Feb", [][]any{{"Qty", "Item", "Note"}, {"2", "ink", "late"}}},
+	)
+	checkOutputs(t, []string{"-i", book, "-all", "-flatten", "-csv"}, map[string]string{
+		"":                 "Item,Qty,Note\npen,1,\nink,2,late\n",
+		"-sheet-col Month": "Item,Qty,Month,Note\npen,1,Jan,\nink,2,Feb,late\n",
+	})
+	if _, _, err := run(t, "", "-i", book, "-flatten", "-csv"); err == nil {
+		t.Error("-flatten of a single sheet should fail")
+	}
+}
+
+func TestExpectCols(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"-expect-cols", "Name,Age,City"}, true},
+		{[]string{"-expect-cols", "City,Name,Age"}, false},
+		{[]string{"-expect-cols", "City,Name,Age", "-expect-unordered"}, true},
+		{[]string{"-expect-cols", "Name,Age"}, false},
+	} {
+		_, _, err := run(t, "", append([]string{"-i", people(t), "-csv"}, tc.args...)...)
+		if (err == nil) != tc.ok {
+			t.Errorf("%v: got %v, want success %v", tc.args, err, tc.ok)
+		}
+	}
+}
+
+func TestGzipInput(t *testing.T) {
+	raw, err := os.ReadFile(people(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "book.xlsx.gz")
+	if err := os.WriteFile(path, gzipped(t, raw), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := mustRun(t, "", "-i", path, "-csv", "-head", "1"), "Name,Age,City\nAlice,30,Paris\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := mustRun(t, string(gzipped(t, []byte("Name\nAlice\n"))), "-from-csv", "-csv"); got != "Name\nAlice\n" {
+		t.Errorf("CSV on stdin: got %q", got)
+	}
+}
+
+// Compress raw with gzip
+func gzipped(t *testing.T, raw []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(raw)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestNoInfo(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"A", "A"}, {"1", "2"}}})
+	_, stderr, err := run(t, "", "-i", book, "-json", "-no-info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stderr, "info:") || !strings.Contains(stderr, "warn: duplicate column title") {
+		t.Errorf("want warnings without the summary, got %q", stderr)
+	}
+}
+
+func TestGzipOutput(t *testing.T) {
+	want := "Name,Age,City\nAlice,30,Paris\n"
+	path := filepath.Join(t.TempDir(), "out.csv.gz")
+	mustRun(t, "", "-i", people(t), "-csv", "-head", "1", "-o", path)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gunzip(t, raw); got != want {
+		t.Errorf(".gz path: got %q, want %q", got, want)
+	}
+	if got := gunzip(t, []byte(mustRun(t, "", "-i", people(t), "-csv", "-head", "1", "-gzip"))); got != want {
+		t.Errorf("-gzip: got %q, want %q", got, want)
+	}
+}
+
+// Decompress gzipped output
+func gunzip(t *testing.T, raw []byte) string {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestNumberSeparators(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"G", "Amount"}, {"a", "1.234,5"}, {"a", "99,25"}, {"b", "1.000"}}})
+	checkOutputs(t, []string{"-i", book, "-csv", "-decimal-sep", ",", "-thousands-sep", "."}, map[string]string{
+		"-sort Amount":                "G,Amount\na,\"99,25\"\nb,1.000\na,\"1.234,5\"\n",
+		"-group-by G -agg Amount:sum": "G,Amount_sum\na,1333.75\nb,1000\n",
+	})
+	if out := mustRun(t, "", "-i", book, "-stats", "-decimal-sep", ",", "-thousands-sep", "."); !strings.Contains(out, "min: 99.25 max: 1234.5") {
+		t.Errorf("missing localized stats in:\n%s", out)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.csv")
+	stdout, stderr, err := run(t, "", "-i", people(t), "-csv", "-where", "Age!=25", "-o", out, "-dry-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout != "" {
+		t.Errorf("unexpected output %q", stdout)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("-dry-run wrote %s", out)
+	}
+	for _, want := range []string{`sheet: "People" #rows: 2`, "columns: Name, Age, City", "-where=Age!=25"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("missing %q in:\n%s", want, stderr)
+		}
+	}
+}
+
+func TestProtoSafe(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"2nd Place", "Café"}, {"x", "y"}}})
+	checkOutputs(t, []string{"-i", book, "-json"}, map[string]string{
+		"-snake":      "{\"Sheet1\":{\"2nd_place\":[\"x\"],\"café\":[\"y\"]}}\n",
+		"-proto-safe": "{\"Sheet1\":{\"_2nd_place\":[\"x\"],\"caf\":[\"y\"]}}\n",
+	})
+	_, stderr, err := run(t, "", "-i", book, "-json", "-proto-safe", "-print-mapping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr, "2nd Place") || !strings.Contains(stderr, "_2nd_place") {
+		t.Errorf("missing mapping in:\n%s", stderr)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t), "-head", "1"}, map[string]string{
+		"-ndjson":               "{\"Name\":\"Alice\",\"Age\":\"30\",\"City\":\"Paris\"}\n",
+		"-ndjson -order sorted": "{\"Age\":\"30\",\"City\":\"Paris\",\"Name\":\"Alice\"}\n",
+		"-records":              "[{\"Name\":\"Alice\",\"Age\":\"30\",\"City\":\"Paris\"}]\n",
+	})
+}
+
+func TestCountDistinct(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Color"}, {"red"}, {""}, {"blue"}, {"red"}}})
+	checkOutputs(t, []string{"-i", book, "-count-distinct", "Color"}, map[string]string{
+		"":                             "3\n",
+		"-ignore-empty":                "2\n",
+		"-list-distinct -ignore-empty": "2\nblue\nred\n",
+		"-json":                        "{\"Sheet1\":{\"count\":3}}\n",
+	})
+}
+
+func TestPivot(t *testing.T) {
+	book := workbook(t, sheetData{"Sales", [][]any{
+		{"Region", "Quarter", "Amount"},
+		{"east", "Q1", 10},
+		{"east", "Q2", 5},
+		{"west", "Q1", 7},
+		{"east", "Q1", 3},
+	}})
+	checkOutputs(t, []string{"-i", book, "-csv", "-pivot", "-pivot-rows", "Region", "-pivot-cols", "Quarter", "-pivot-val", "Amount"}, map[string]string{
+		"":                 "Region,Q1,Q2\neast,13,5\nwest,7,\n",
+		"-pivot-agg count": "Region,Q1,Q2\neast,2,1\nwest,1,0\n",
+	})
+}
+
+func TestDefinedName(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"junk"}, {"", "Name", "Age"}, {"", "Alice", "30"}, {"", "", "", "x"}}})
+	edit(t, book, func(f *xl.File) error {
+		return f.SetDefinedName(&xl.DefinedName{Name: "People", RefersTo: "Sheet1!$B$2:$C$3"})
+	})
+	checkOutputs(t, []string{"-i", book, "-csv"}, map[string]string{
+		"-name People": "Name,Age\nAlice,30\n",
+	})
+	if _, _, err := run(t, "", "-i", book, "-csv", "-name", "Nope"); err == nil {
+		t.Error("an unknown -name should fail")
+	}
+}
+
+func TestLimit(t *testing.T) {
+	book := workbook(t,
+		sheetData{"One", [][]any{{"N"}, {"1"}, {"2"}}},
+		sheetData{"Two", [][]any{{"N"}, {"3"}, {"4"}}},
+	)
+	checkOutputs(t, []string{"-i", book, "-all", "-json"}, map[string]string{
+		"-limit 1": "{\"One\":{\"N\":[\"1\"]},\"Two\":{\"N\":[]}}\n",
+		"-limit 3": "{\"One\":{\"N\":[\"1\",\"2\"]},\"Two\":{\"N\":[\"3\"]}}\n",
+	})
+}
+
+func TestSparse(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"A", "", "C"}, {"", "x"}}})
+	checkOutputs(t, []string{"-i", book, "-sparse"}, map[string]string{
+		"":             "{\"Sheet1\":{\"A1\":\"A\",\"B2\":\"x\",\"C1\":\"C\"}}\n",
+		"-skip-rows 1": "{\"Sheet1\":{\"B2\":\"x\"}}\n",
+	})
+	if _, _, err := run(t, "", "-i", book, "-sparse", "-sort", "A"); err == nil {
+		t.Error("-sparse with -sort should fail")
+	}
+	for i := 0; i < 5; i++ {
+		_, stderr, _ := run(t, "", "-i", book, "-sparse", "-transpose", "-sort", "A", "-head", "1")
+		if want := "-head can't be used with -sparse\n"; stderr != want {
+			t.Fatalf("-sparse with many conflicts: got %q, want %q", stderr, want)
+		}
+	}
+}
+
+func TestMergeHeaders(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Sales", "", "Costs"}, {"Q1", "Q2", "Q1"}, {"1", "2", "3"}}})
+	checkOutputs(t, []string{"-i", book, "-csv", "-merge-headers", "2"}, map[string]string{
+		"":              "Sales Q1,Sales Q2,Costs Q1\n1,2,3\n",
+		"-header-sep _": "Sales_Q1,Sales_Q2,Costs_Q1\n1,2,3\n",
+	})
+}
+
+func TestCast(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Age", "Price", "Active"}, {"30", "1.5", "TRUE"}, {"n/a", "2", "no"}}})
+	checkOutputs(t, []string{"-i", book, "-cast", "Age:int,Price:float,Active:bool"}, map[string]string{
+		"-json":    "{\"Sheet1\":{\"Active\":[true,false],\"Age\":[30,null],\"Price\":[1.5,2]}}\n",
+		"-records": "[{\"Age\":30,\"Price\":1.5,\"Active\":true},{\"Age\":null,\"Price\":2,\"Active\":false}]\n",
+	})
+}
+
+func TestAppendTo(t *testing.T) {
+	target := workbook(t, sheetData{"Old", [][]any{{"Keep"}, {"me"}}})
+	mustRun(t, "", "-i", people(t), "-xlsx", "-append-to", target, "-sheet-name", "New")
+	if got, want := mustRun(t, "", "-i", target, "-all", "-csv", "-head", "1"), "Keep\nme\n\nName,Age,City\nAlice,30,Paris\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, _, err := run(t, "", "-i", people(t), "-xlsx", "-append-to", target, "-sheet-name", "New"); err == nil {
+		t.Error("appending an existing sheet without -overwrite-sheet should fail")
+	}
+	mustRun(t, "", "-i", threeSheets(t), "-xlsx", "-append-to", target, "-sheet-name", "New", "-overwrite-sheet")
+	if got, want := mustRun(t, "", "-i", target, "-sheet", "New", "-csv"), "Sheet\none\n"; got != want {
+		t.Errorf("-overwrite-sheet: got %q, want %q", got, want)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	a := mustRun(t, "", "-i", people(t), "-checksum")
+	if !strings.HasPrefix(a, "People: ") || len(a) != len("People: ")+64+1 {
+		t.Fatalf("unexpected -checksum output %q", a)
+	}
+	if b := mustRun(t, "", "-i", people(t), "-checksum"); b != a {
+		t.Errorf("same cells, different checksums: %q and %q", a, b)
+	}
+	book := people(t)
+	edit(t, book, func(f *xl.File) error { return f.SetCellValue("People", "C4", "Roma") })
+	if c := mustRun(t, "", "-i", book, "-checksum"); c == a {
+		t.Error("changed cells, same checksum")
+	}
+	var sums map[string]string
+	if err := json.Unmarshal([]byte(mustRun(t, "", "-i", people(t), "-checksum", "-json")), &sums); err != nil || "People: "+sums["People"]+"\n" != a {
+		t.Errorf("-json: %v %v", sums, err)
+	}
+}
+
+func TestFlat(t *testing.T) {
+	checkOutputs(t, []string{"-i", threeSheets(t), "-flat"}, map[string]string{
+		"":                "{\"Sheet\":\"one\"}\n",
+		"-prefix x_":      "{\"x_Sheet\":\"one\"}\n",
+		"-all -prefix x_": "{\"x_One.Sheet\":\"one\"}\n{\"x_Two.Sheet\":\"two\"}\n{\"x_Three.Sheet\":\"three\"}\n",
+	})
+}
+
+// Piped input isn't a terminal, so -interactive reads the active sheet without asking
+func TestInteractivePiped(t *testing.T) {
+	stdout, stderr, err := run(t, "", "-quiet", "-csv", "-interactive", "-i", threeSheets(t))
+	if err != nil {
+		t.Fatalf("%v: %s", err, stderr)
+	}
+	if stderr != "" {
+		t.Errorf("prompted: %q", stderr)
+	}
+	if want := "Sheet\none\n"; stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+}
+
+func TestWithIndex(t *testing.T) {
+	checkOutputs(t, []string{"-i", people(t), "-with-index"}, map[string]string{
+		"-csv -sort Age -where City!=Rome": "_row,Name,Age,City\n3,Bob,25,Berlin\n2,Alice,30,Paris\n",
+		"-json":                            "{\"People\":{\"Age\":[\"30\",\"25\",\"41\"],\"City\":[\"Paris\",\"Berlin\",\"Rome\"],\"Name\":[\"Alice\",\"Bob\",\"Carol\"],\"_row\":[\"2\",\"3\",\"4\"]}}\n",
+	})
+}
+
+func TestGoStructNames(t *testing.T) {
+	book := workbook(t,
+		sheetData{"Sales Q1", [][]any{{"a`b", "Total"}, {"x", 1}}},
+		sheetData{"Sales-Q1", [][]any{{"Name"}, {"y"}}},
+	)
+
+	src := mustRun(t, "", "-quiet", "-gostruct", "-all", book)
+	if _, err := parser.ParseFile(token.NewFileSet(), "", "package p\n"+src, 0); err != nil {
+		t.Fatalf("invalid Go: %v\n%s", err, src)
+	}
+	for _, want := range []string{"type SalesQ1 struct", "type SalesQ12 struct", "var SalesQ12Rows", `"json:\"a` + "`" + `b\""`} {
+		if !strings.Contains(src, want) {
+			t.Errorf("output lacks %s:\n%s", want, src)
+		}
+	}
+}
+
+func TestColumnsWhere(t *testing.T) {
+	got := mustRun(t, "", "-quiet", "-csv", "-columns", "Name", "-where", "Age=30", people(t))
+	if want := "Name\nAlice\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStatsIntFloat(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Price"}, {"3"}, {"1.5"}, {"2.25"}, {"x"}}})
+	got := mustRun(t, "", "-quiet", "-stats", book)
+	if !strings.Contains(got, "type: float mismatch: 1") {
+		t.Errorf("want float with only the text cell mismatched, got:\n%s", got)
+	}
+}
+
+func TestHyperlinksBySheet(t *testing.T) {
+	book := workbook(t,
+		sheetData{"Links", [][]any{{"Site"}, {"home"}, {"docs"}}},
+		sheetData{"Plain", [][]any{{"Site"}, {"home (https://example.com)"}}},
+	)
+	f, err := xl.OpenFile(book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cell := range []string{"A2", "A3"} {
+		if err := f.SetCellHyperLink("Links", cell, "https://example.com", "External"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.AddComment("Links", "A3", `{"author":"","text":"note"}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := mustRun(t, "", "-quiet", "-records", "-all", "-hyperlinks", "-comments", book)
+	want := `{"Links":[{"Site":{"text":"home","link":"https://example.com"}},{"Site":{"text":"docs (note)","link":"https://example.com"}}],"Plain":[{"Site":"home (https://example.com)"}]}` + "\n"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestColumnsSort(t *testing.T) {
+	got := mustRun(t, "", "-quiet", "-csv", "-columns", "Name", "-sort", "Age", people(t))
+	if want := "Name\nBob\nAlice\nCarol\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// Run with -race to check that sheets read in parallel don't share excelize state
+func TestJobsComments(t *testing.T) {
+	var sheets []sheetData
+	for i := 1; i <= 6; i++ {
+		sheets = append(sheets, sheetData{"S" + strconv.Itoa(i), [][]any{{"Name", "Score"}, {"a", i}, {"b", i * 2}}})
+	}
+	book := workbook(t, sheets...)
+	f, err := xl.OpenFile(book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sheet := range sheets {
+		if err := f.AddComment(sheet.name, "A2", `{"author":"","text":"on `+sheet.name+`"}`); err != nil {
+			t.Fatal(err)
+		}
+		style, err := f.NewStyle(&xl.Style{Font: &xl.Font{Bold: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.SetCellStyle(sheet.name, "B2", "B2", style); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.SetCellHyperLink(sheet.name, "A3", "https://example.com/"+sheet.name, "External"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := mustRun(t, "", "-quiet", "-json", "-all", "-jobs", "6", "-comments", "-styles", "-hyperlinks", "-eval", "-unmerge", "-dates", book)
+	var out struct {
+		Comments map[string]map[string]string    `json:"_comments"`
+		Styles   map[string]map[string]cellStyle `json:"_styles"`
+	}
+	if err := json.Unmarshal([]byte(got), &out); err != nil {
+		t.Fatalf("%v: %s", err, got)
+	}
+	var cells map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(got), &cells); err != nil {
+		t.Fatal(err)
+	}
+	for i, sheet := range sheets {
+		want := `{"Name":["a",{"text":"b","link":"https://example.com/` + sheet.name + `"}],"Score":["` + strconv.Itoa(i+1) + `","` + strconv.Itoa(2*(i+1)) + `"]}`
+		if string(cells[sheet.name]) != want {
+			t.Errorf("sheet %s: got %s, want %s", sheet.name, cells[sheet.name], want)
+		}
+	}
+	for _, sheet := range sheets {
+		if c := out.Comments[sheet.name]["A2"]; c != "on "+sheet.name {
+			t.Errorf("sheet %s: comment %q", sheet.name, c)
+		}
+		if !out.Styles[sheet.name]["B2"].Bold {
+			t.Errorf("sheet %s: B2 isn't bold", sheet.name)
+		}
+	}
+}
+
+func TestBoolsBySheet(t *testing.T) {
+	book := workbook(t,
+		sheetData{"Flags", [][]any{{"Active"}, {"yes"}, {"no"}}},
+		sheetData{"Words", [][]any{{"Active"}, {"true"}, {"maybe"}}},
+	)
+	got := mustRun(t, "", "-quiet", "-records", "-all", "-bool-as", "json", book)
+	want := `{"Flags":[{"Active":true},{"Active":false}],"Words":[{"Active":"true"},{"Active":"maybe"}]}` + "\n"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// Matrix JSON cells are converted by their column's title, and the titles themselves are left alone
+func TestMatrixJSONCells(t *testing.T) {
+	book := workbook(t, sheetData{"Sheet1", [][]any{{"Done", "", "Age"}, {"yes", "x", "30"}, {"no", "", "n/a"}}})
+	checkOutputs(t, []string{"-i", book, "-json", "-table"}, map[string]string{
+		"-bool-as json": "{\"Sheet1\":[[\"Done\",true,false],[\"\",\"x\",\"\"],[\"Age\",\"30\",\"n/a\"]]}\n",
+		"-null-as null": "{\"Sheet1\":[[\"Done\",\"yes\",\"no\"],[\"\",\"x\",null],[\"Age\",\"30\",\"n/a\"]]}\n",
+	})
+}
+
+func TestSplitGzip(t *testing.T) {
+	dir := t.TempDir()
+	mustRun(t, "", "-quiet", "-csv", "-split", "-gzip", "-o", filepath.Join(dir, "x_{sheet}.csv"), people(t))
+
+	f, err := os.Open(filepath.Join(dir, "x_People.csv.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(got), "Name,Age,City\n") {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestGoStructLocale(t *testing.T) {
+	book := workbook(t, sheetData{"Prices", [][]any{{"Price"}, {"1.234"}, {"1,5"}}})
+	got := mustRun(t, "", "-quiet", "-gostruct", "-decimal-sep", ",", "-thousands-sep", ".", book)
+	for _, want := range []string{"Price float64", "{Price: 1234}", "{Price: 1.5}"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %s:\n%s", want, got)
+		}
+	}
+}
+
+func TestDryRunColumnsWhere(t *testing.T) {
+	stdout, stderr, err := run(t, "", "-quiet", "-dry-run", "-csv", "-columns", "Name", "-where", "Age=30", people(t))
+	if err != nil {
+		t.Fatalf("%v: %s", err, stderr)
+	}
+	if stdout != "" {
+		t.Errorf("dry run wrote output: %q", stdout)
+	}
+	if want := `sheet: "People" #rows: 1 #cols: 1 columns: Name`; !strings.Contains(stderr, want) {
+		t.Errorf("plan lacks %s:\n%s", want, stderr)
+	}
+}
+
+func TestDryRunSecrets(t *testing.T) {
+	book := filepath.Join("testdata", "encrypted.xlsx")
+	_, stderr, err := run(t, "", "-json", "-dry-run", "-password", "password", "-header", "Authorization: Bearer token", "-i", book)
+	if err != nil {
+		t.Fatalf("%v: %s", err, stderr)
+	}
+	if strings.Contains(stderr, "=password") || strings.Contains(stderr, "token") {
+		t.Errorf("secrets printed:\n%s", stderr)
+	}
+	for _, want := range []string{"-password=***", "-header=Authorization: ***"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("missing %q in:\n%s", want, stderr)
+		}
+	}
+}
+
+// /dev/null is a character device but not a terminal, so there's no prompt
+func TestInteractiveDevNull(t *testing.T) {
+	book := workbook(t,
+		sheetData{"First", [][]any{{"A"}, {"1"}}},
+		sheetData{"Second", [][]any{{"B"}, {"2"}}},
+	)
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+
+	cmd := command(t, "-quiet", "-csv", "-interactive", "-i", book)
+	cmd.Stdin = null
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%v: %s", err, stderr.String())
+	}
+	if stderr.Len() > 0 {
+		t.Errorf("prompted: %q", stderr.String())
+	}
+	if got, want := stdout.String(), "A\n1\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}